@@ -4,14 +4,16 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
 
 	//"github.com/fsnotify/fsnotify"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
 	"golang.org/x/sys/unix"
 )
 
@@ -64,7 +66,7 @@ func checkCgroup(c *Container) error {
 }
 
 // https://github.com/opencontainers/runtime-spec/blob/v1.0.2/config-linux.md
-// TODO New spec will contain a property Unified for cgroupv2 properties
+// Unified resources are cgroup v2 properties that are written as is.
 // https://github.com/opencontainers/runtime-spec/blob/master/config-linux.md#unified
 func configureCgroup(rt *Runtime, c *Container) error {
 	if err := configureCgroupPath(rt, c); err != nil {
@@ -86,29 +88,17 @@ func configureCgroup(rt *Runtime, c *Container) error {
 
 	}
 
-	if mem := c.Spec.Linux.Resources.Memory; mem != nil {
-		c.Log.Debug().Msg("TODO cgroup memory controller not implemented")
-	}
-
-	if cpu := c.Spec.Linux.Resources.CPU; cpu != nil {
-		if err := configureCPUController(rt, cpu); err != nil {
-			return err
-		}
+	vals, err := resourceValues(c.Spec.Linux.Resources)
+	if err != nil {
+		return err
 	}
-
-	if pids := c.Spec.Linux.Resources.Pids; pids != nil {
-		if err := c.setConfigItem("lxc.cgroup2.pids.max", fmt.Sprintf("%d", pids.Limit)); err != nil {
-			return err
-		}
+	if err := checkCgroupResources(c, c.Spec.Linux.Resources, vals); err != nil {
+		return err
 	}
-	if blockio := c.Spec.Linux.Resources.BlockIO; blockio != nil {
-		c.Log.Debug().Msg("TODO cgroup blockio controller not implemented")
+	if err := setCgroupValues(c, vals); err != nil {
+		return err
 	}
 
-	if hugetlb := c.Spec.Linux.Resources.HugepageLimits; hugetlb != nil {
-		// set Hugetlb limit (in bytes)
-		c.Log.Debug().Msg("TODO cgroup hugetlb controller not implemented")
-	}
 	if net := c.Spec.Linux.Resources.Network; net != nil {
 		c.Log.Debug().Msg("TODO cgroup network controller not implemented")
 	}
@@ -210,46 +200,606 @@ func configureDeviceController(c *Container) error {
 	return nil
 }
 
-func configureCPUController(clxc *Runtime, slinux *specs.LinuxCPU) error {
-	// CPU resource restriction configuration
-	// use strconv.FormatUint(n, 10) instead of fmt.Sprintf ?
-	clxc.Log.Debug().Msg("TODO configure cgroup cpu controller")
-	/*
-		if cpu.Shares != nil && *cpu.Shares > 0 {
-				if err := clxc.setConfigItem("lxc.cgroup2.cpu.shares", fmt.Sprintf("%d", *cpu.Shares)); err != nil {
-					return err
-				}
+// resourceValues translates the given spec resources into cgroup v2 values.
+// Values from the Unified resources take precedence over
+// the values generated from the other resources.
+func resourceValues(res *specs.LinuxResources) (cgroupValues, error) {
+	vals := cgroupValues{}
+	if res == nil {
+		return vals, nil
+	}
+
+	add := func(name string, v cgroupValues, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to configure cgroup %s controller: %w", name, err)
 		}
-		if cpu.Quota != nil && *cpu.Quota > 0 {
-			if err := clxc.setConfigItem("lxc.cgroup2.cpu.cfs_quota_us", fmt.Sprintf("%d", *cpu.Quota)); err != nil {
-				return err
-			}
+		for key, val := range v {
+			vals[key] = val
+		}
+		return nil
+	}
+
+	if mem := res.Memory; mem != nil {
+		v, err := memoryValues(mem)
+		if err := add("memory", v, err); err != nil {
+			return nil, err
+		}
+	}
+	if cpu := res.CPU; cpu != nil {
+		v, err := cpuValues(cpu)
+		if err := add("cpu", v, err); err != nil {
+			return nil, err
+		}
+	}
+	if pids := res.Pids; pids != nil {
+		vals["pids.max"] = pidsMax(pids.Limit)
+	}
+	if blockio := res.BlockIO; blockio != nil {
+		v, err := ioValues(blockio)
+		if err := add("io", v, err); err != nil {
+			return nil, err
+		}
+	}
+	if hugetlb := res.HugepageLimits; len(hugetlb) > 0 {
+		v, err := hugetlbValues(hugetlb)
+		if err := add("hugetlb", v, err); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, val := range res.Unified {
+		if err := checkUnifiedKey(key); err != nil {
+			return nil, err
+		}
+		vals[key] = val
+	}
+	return vals, nil
+}
+
+// checkUnifiedKey returns an error if the given key from the
+// Unified resources is not a controller interface file within
+// the container cgroup, e.g memory.high
+func checkUnifiedKey(key string) error {
+	if strings.ContainsAny(key, "/\x00") || strings.HasPrefix(key, ".") {
+		return fmt.Errorf("invalid unified resource key %q: must be a file within the container cgroup", key)
+	}
+	if cgroupController(key) == "" {
+		return fmt.Errorf("invalid unified resource key %q: expected <controller>.<file>", key)
+	}
+	// e.g cgroup.procs or cgroup.subtree_control
+	if cgroupController(key) == "cgroup" {
+		return fmt.Errorf("invalid unified resource key %q: core interface files are managed by the runtime", key)
+	}
+	return nil
+}
+
+// cgroupController returns the controller name of the given
+// cgroup interface file name, e.g memory for memory.max
+func cgroupController(key string) string {
+	i := strings.Index(key, ".")
+	if i < 1 || i == len(key)-1 {
+		return ""
+	}
+	return key[:i]
+}
+
+// checkCgroupResources checks that the controllers required by the given
+// cgroup values are enabled for the container cgroup.
+// Only the io and hugetlb controllers and the controllers of the
+// Unified resources are checked.
+func checkCgroupResources(c *Container, res *specs.LinuxResources, vals cgroupValues) error {
+	var controllers []string
+	seen := make(map[string]bool)
+	for _, key := range vals.keys() {
+		name := cgroupController(key)
+		_, unified := res.Unified[key]
+		if seen[name] || !(unified || name == "io" || name == "hugetlb") {
+			continue
+		}
+		seen[name] = true
+		controllers = append(controllers, name)
+	}
+	if len(controllers) > 0 {
+		if err := checkCgroupControllers(c, controllers...); err != nil {
+			return err
+		}
+	}
+	if seen["io"] && res.BlockIO != nil {
+		return checkBlockDevices(res.BlockIO)
+	}
+	return nil
+}
+
+// mergeResources merges the resources set in update into a copy of res.
+// Pointer fields of the memory and CPU resources are merged individually,
+// all other resources are replaced if they are set in update.
+// The returned changed resources contain the merged resources of the
+// controllers affected by the update and the Unified resources for them.
+func mergeResources(res *specs.LinuxResources, update *specs.LinuxResources) (merged *specs.LinuxResources, changed *specs.LinuxResources) {
+	merged = new(specs.LinuxResources)
+	if res != nil {
+		*merged = *res
+	}
+	changed = new(specs.LinuxResources)
+	controllers := make(map[string]bool)
+
+	if u := update.Memory; u != nil {
+		m := specs.LinuxMemory{}
+		if merged.Memory != nil {
+			m = *merged.Memory
+		}
+		if u.Limit != nil {
+			m.Limit = u.Limit
+		}
+		if u.Reservation != nil {
+			m.Reservation = u.Reservation
+		}
+		if u.Swap != nil {
+			m.Swap = u.Swap
+		}
+		if u.Kernel != nil {
+			m.Kernel = u.Kernel
+		}
+		if u.KernelTCP != nil {
+			m.KernelTCP = u.KernelTCP
+		}
+		if u.Swappiness != nil {
+			m.Swappiness = u.Swappiness
+		}
+		if u.DisableOOMKiller != nil {
+			m.DisableOOMKiller = u.DisableOOMKiller
+		}
+		if u.UseHierarchy != nil {
+			m.UseHierarchy = u.UseHierarchy
 		}
-			if cpu.Period != nil && *cpu.Period != 0 {
-				if err := clxc.setConfigItem("lxc.cgroup2.cpu.cfs_period_us", fmt.Sprintf("%d", *cpu.Period)); err != nil {
-					return err
-				}
+		merged.Memory = &m
+		changed.Memory = &m
+		controllers["memory"] = true
+	}
+
+	if u := update.CPU; u != nil {
+		cpu := specs.LinuxCPU{}
+		if merged.CPU != nil {
+			cpu = *merged.CPU
+		}
+		if u.Shares != nil {
+			cpu.Shares = u.Shares
+		}
+		if u.Quota != nil {
+			cpu.Quota = u.Quota
+		}
+		if u.Period != nil {
+			cpu.Period = u.Period
+		}
+		if u.RealtimeRuntime != nil {
+			cpu.RealtimeRuntime = u.RealtimeRuntime
+		}
+		if u.RealtimePeriod != nil {
+			cpu.RealtimePeriod = u.RealtimePeriod
+		}
+		if u.Cpus != "" {
+			cpu.Cpus = u.Cpus
+		}
+		if u.Mems != "" {
+			cpu.Mems = u.Mems
+		}
+		merged.CPU = &cpu
+		changed.CPU = &cpu
+		controllers["cpu"] = true
+		controllers["cpuset"] = true
+	}
+
+	if update.Pids != nil {
+		merged.Pids = update.Pids
+		changed.Pids = update.Pids
+		controllers["pids"] = true
+	}
+
+	if update.BlockIO != nil {
+		merged.BlockIO = update.BlockIO
+		changed.BlockIO = update.BlockIO
+		controllers["io"] = true
+	}
+
+	if len(update.HugepageLimits) > 0 {
+		merged.HugepageLimits = update.HugepageLimits
+		changed.HugepageLimits = update.HugepageLimits
+		controllers["hugetlb"] = true
+	}
+
+	if len(merged.Unified) > 0 || len(update.Unified) > 0 {
+		unified := make(map[string]string, len(merged.Unified)+len(update.Unified))
+		for key, val := range merged.Unified {
+			unified[key] = val
+		}
+		for key, val := range update.Unified {
+			unified[key] = val
+		}
+		merged.Unified = unified
+	}
+	for key, val := range merged.Unified {
+		_, updated := update.Unified[key]
+		if updated || controllers[cgroupController(key)] {
+			if changed.Unified == nil {
+				changed.Unified = make(map[string]string)
 			}
-		if cpu.Cpus != "" {
-			if err := clxc.setConfigItem("lxc.cgroup2.cpuset.cpus", cpu.Cpus); err != nil {
+			changed.Unified[key] = val
+		}
+	}
+	return merged, changed
+}
+
+// cgroupValues maps cgroup v2 interface files (e.g memory.max)
+// to the values written to them.
+// Some interface files (e.g io.max) accept only a single entry per write.
+// Multiple entries for such a file are separated by newline.
+type cgroupValues map[string]string
+
+// keys returns the interface file names in lexical order.
+func (vals cgroupValues) keys() []string {
+	keys := make([]string, 0, len(vals))
+	for key := range vals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setCgroupValues sets a liblxc config item 'lxc.cgroup2.{key}'
+// for each entry of the given values.
+// The config items are set in lexical order of the keys.
+func setCgroupValues(c *Container, vals cgroupValues) error {
+	for _, key := range vals.keys() {
+		for _, val := range strings.Split(vals[key], "\n") {
+			if err := c.setConfigItem("lxc.cgroup2."+key, val); err != nil {
 				return err
 			}
 		}
-		if cpu.RealtimePeriod != nil && *cpu.RealtimePeriod > 0 {
-			if err := clxc.setConfigItem("lxc.cgroup2.cpu.rt_period_us", fmt.Sprintf("%d", *cpu.RealtimePeriod)); err != nil {
-				return err
+	}
+	return nil
+}
+
+// checkCgroupControllers returns an error if one of the given controllers
+// is not enabled in cgroup.subtree_control of the container cgroup parent.
+// If the parent cgroup does not exist yet, the controllers must be
+// available in cgroup.controllers of the nearest existing ancestor.
+func checkCgroupControllers(c *Container, controllers ...string) error {
+	filename := "cgroup.subtree_control"
+	dir := filepath.Dir(filepath.Join(cgroupRoot, c.CgroupDir))
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		if dir == cgroupRoot || dir == "/" {
+			return fmt.Errorf("no parent cgroup for %s", c.CgroupDir)
+		}
+		filename = "cgroup.controllers"
+		dir = filepath.Dir(dir)
+	}
+
+	p := filepath.Join(dir, filename)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("failed to read enabled cgroup controllers: %w", err)
+	}
+	enabled := strings.Fields(string(data))
+	for _, name := range controllers {
+		found := false
+		for _, e := range enabled {
+			if e == name {
+				found = true
+				break
 			}
 		}
-		if cpu.RealtimeRuntime != nil && *cpu.RealtimeRuntime > 0 {
-			if err := clxc.setConfigItem("lxc.cgroup2.cpu.rt_runtime_us", fmt.Sprintf("%d", *cpu.RealtimeRuntime)); err != nil {
+		if !found {
+			return fmt.Errorf("cgroup controller %q is not enabled in %s", name, p)
+		}
+	}
+	return nil
+}
+
+// cgroupLimit formats the given limit value for a cgroup v2 interface file.
+// The value -1 means unlimited and is formatted as "max".
+func cgroupLimit(v int64) (string, error) {
+	if v == -1 {
+		return "max", nil
+	}
+	if v < 0 {
+		return "", fmt.Errorf("invalid limit value %d", v)
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+// pidsMax returns the pids.max value for the given limit.
+// A limit value <= 0 means unlimited.
+func pidsMax(limit int64) string {
+	if limit <= 0 {
+		return "max"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// memoryValues translates the given spec memory resources
+// into cgroup v2 memory controller values.
+// A limit value of 0 is treated as unset.
+// See https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html#memory-interface-files
+func memoryValues(mem *specs.LinuxMemory) (cgroupValues, error) {
+	vals := cgroupValues{}
+
+	var limit int64
+	if mem.Limit != nil && *mem.Limit != 0 {
+		limit = *mem.Limit
+		val, err := cgroupLimit(limit)
+		if err != nil {
+			return nil, fmt.Errorf("memory limit: %w", err)
+		}
+		vals["memory.max"] = val
+	}
+
+	if mem.Reservation != nil && *mem.Reservation != 0 {
+		val, err := cgroupLimit(*mem.Reservation)
+		if err != nil {
+			return nil, fmt.Errorf("memory reservation: %w", err)
+		}
+		vals["memory.low"] = val
+	}
+
+	var swap int64
+	if mem.Swap != nil {
+		swap = *mem.Swap
+	}
+	swapMax, err := memorySwapMax(limit, swap)
+	if err != nil {
+		return nil, err
+	}
+	if swapMax != "" {
+		vals["memory.swap.max"] = swapMax
+	}
+
+	if mem.Kernel != nil && *mem.Kernel != 0 {
+		return nil, fmt.Errorf("kernel memory limit is not supported by cgroup v2")
+	}
+	if mem.KernelTCP != nil && *mem.KernelTCP != 0 {
+		return nil, fmt.Errorf("kernel TCP memory limit is not supported by cgroup v2")
+	}
+	// Some callers always set swappiness to 0 or -1 (the default),
+	// which is treated as unset.
+	if mem.Swappiness != nil && *mem.Swappiness != 0 && *mem.Swappiness != math.MaxUint64 {
+		return nil, fmt.Errorf("memory swappiness is not supported by cgroup v2")
+	}
+	if mem.DisableOOMKiller != nil && *mem.DisableOOMKiller {
+		return nil, fmt.Errorf("disabling the OOM killer is not supported by cgroup v2")
+	}
+	if mem.UseHierarchy != nil && !*mem.UseHierarchy {
+		return nil, fmt.Errorf("disabling hierarchical memory accounting is not supported by cgroup v2")
+	}
+	return vals, nil
+}
+
+// memorySwapMax converts the cgroup v1 swap limit (memory + swap)
+// into the cgroup v2 value for memory.swap.max which excludes memory.
+// An empty string is returned if memory.swap.max should not be set.
+// The conversion matches the one used by runc and crun.
+func memorySwapMax(limit int64, swap int64) (string, error) {
+	// Unlimited memory without an explicit swap limit means unlimited swap.
+	if limit == -1 && swap == 0 {
+		return "max", nil
+	}
+	if swap == 0 {
+		return "", nil
+	}
+	if swap == -1 {
+		return "max", nil
+	}
+	if swap < 0 {
+		return "", fmt.Errorf("invalid memory swap limit %d", swap)
+	}
+	if limit == 0 {
+		return "", fmt.Errorf("memory swap limit %d requires a memory limit", swap)
+	}
+	if limit == -1 {
+		return "", fmt.Errorf("memory swap limit %d requires a finite memory limit", swap)
+	}
+	if swap < limit {
+		return "", fmt.Errorf("memory swap limit %d must be greater than or equal to memory limit %d", swap, limit)
+	}
+	return strconv.FormatInt(swap-limit, 10), nil
+}
+
+// cpuValues translates the given spec CPU resources into
+// cgroup v2 cpu and cpuset controller values.
+// See https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html#cpu-interface-files
+func cpuValues(cpu *specs.LinuxCPU) (cgroupValues, error) {
+	vals := cgroupValues{}
+
+	if cpu.Shares != nil && *cpu.Shares != 0 {
+		vals["cpu.weight"] = strconv.FormatUint(cpuSharesToWeight(*cpu.Shares), 10)
+	}
+
+	var quota int64
+	if cpu.Quota != nil {
+		quota = *cpu.Quota
+	}
+	var period uint64
+	if cpu.Period != nil {
+		period = *cpu.Period
+	}
+	if quota != 0 || period != 0 {
+		// The default period for cpu.max is 100ms
+		if period == 0 {
+			period = 100000
+		}
+		max := "max"
+		if quota > 0 {
+			max = strconv.FormatInt(quota, 10)
+		}
+		vals["cpu.max"] = fmt.Sprintf("%s %d", max, period)
+	}
+
+	if cpu.Cpus != "" {
+		vals["cpuset.cpus"] = cpu.Cpus
+	}
+	if cpu.Mems != "" {
+		vals["cpuset.mems"] = cpu.Mems
+	}
+
+	if (cpu.RealtimeRuntime != nil && *cpu.RealtimeRuntime != 0) ||
+		(cpu.RealtimePeriod != nil && *cpu.RealtimePeriod != 0) {
+		return nil, fmt.Errorf("realtime CPU scheduling is not supported by cgroup v2")
+	}
+	return vals, nil
+}
+
+// ioValues translates the given spec block IO resources
+// into cgroup v2 io controller values.
+// See https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html#io-interface-files
+func ioValues(blockio *specs.LinuxBlockIO) (cgroupValues, error) {
+	vals := cgroupValues{}
+
+	if blockio.LeafWeight != nil && *blockio.LeafWeight != 0 {
+		return nil, fmt.Errorf("block IO leaf weight is not supported by cgroup v2")
+	}
+
+	var weights []string
+	if blockio.Weight != nil && *blockio.Weight != 0 {
+		weights = append(weights, fmt.Sprintf("default %d", blkioWeightToIOWeight(*blockio.Weight)))
+	}
+	for _, dev := range blockio.WeightDevice {
+		if dev.LeafWeight != nil && *dev.LeafWeight != 0 {
+			return nil, fmt.Errorf("block IO leaf weight for device %d:%d is not supported by cgroup v2", dev.Major, dev.Minor)
+		}
+		if dev.Weight == nil || *dev.Weight == 0 {
+			continue
+		}
+		weights = append(weights, fmt.Sprintf("%d:%d %d", dev.Major, dev.Minor, blkioWeightToIOWeight(*dev.Weight)))
+	}
+	if len(weights) > 0 {
+		vals["io.weight"] = strings.Join(weights, "\n")
+	}
+
+	// io.max accepts a single line per device with all limits for the device.
+	var devices []string
+	limits := make(map[string][]string)
+	throttle := func(key string, list []specs.LinuxThrottleDevice) {
+		for _, dev := range list {
+			id := fmt.Sprintf("%d:%d", dev.Major, dev.Minor)
+			if _, exist := limits[id]; !exist {
+				devices = append(devices, id)
+			}
+			// A cgroup v1 rate of 0 means unlimited.
+			rate := "max"
+			if dev.Rate != 0 {
+				rate = strconv.FormatUint(dev.Rate, 10)
+			}
+			limits[id] = append(limits[id], key+"="+rate)
+		}
+	}
+	throttle("rbps", blockio.ThrottleReadBpsDevice)
+	throttle("wbps", blockio.ThrottleWriteBpsDevice)
+	throttle("riops", blockio.ThrottleReadIOPSDevice)
+	throttle("wiops", blockio.ThrottleWriteIOPSDevice)
+
+	if len(devices) > 0 {
+		lines := make([]string, 0, len(devices))
+		for _, id := range devices {
+			lines = append(lines, id+" "+strings.Join(limits[id], " "))
+		}
+		vals["io.max"] = strings.Join(lines, "\n")
+	}
+	return vals, nil
+}
+
+// blkioWeightToIOWeight converts cgroup v1 blkio.weight [10-1000]
+// to cgroup v2 io.weight [1-10000].
+// The conversion is the same as the one used by runc and crun.
+func blkioWeightToIOWeight(weight uint16) uint64 {
+	w := uint64(weight)
+	if w < 10 {
+		w = 10
+	}
+	if w > 1000 {
+		w = 1000
+	}
+	return 1 + (w-10)*9999/990
+}
+
+// checkBlockDevices returns an error if one of the devices referenced
+// by the given spec block IO resources is not a block device.
+func checkBlockDevices(blockio *specs.LinuxBlockIO) error {
+	check := func(major, minor int64) error {
+		p := fmt.Sprintf("/sys/dev/block/%d:%d", major, minor)
+		if _, err := os.Stat(p); err != nil {
+			return fmt.Errorf("block device %d:%d is not available: %w", major, minor, err)
+		}
+		return nil
+	}
+	for _, dev := range blockio.WeightDevice {
+		if err := check(dev.Major, dev.Minor); err != nil {
+			return err
+		}
+	}
+	for _, list := range [][]specs.LinuxThrottleDevice{
+		blockio.ThrottleReadBpsDevice, blockio.ThrottleWriteBpsDevice,
+		blockio.ThrottleReadIOPSDevice, blockio.ThrottleWriteIOPSDevice,
+	} {
+		for _, dev := range list {
+			if err := check(dev.Major, dev.Minor); err != nil {
 				return err
 			}
 		}
-	*/
-	// Mems string `json:"mems,omitempty"`
+	}
 	return nil
 }
 
+// hugetlbValues translates the given spec hugepage limits
+// into cgroup v2 hugetlb controller values.
+// The page size must be formatted like the page size in the
+// cgroup interface file name, e.g 2MB for hugetlb.2MB.max
+// See https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html#hugetlb-interface-files
+func hugetlbValues(limits []specs.LinuxHugepageLimit) (cgroupValues, error) {
+	vals := cgroupValues{}
+	for _, l := range limits {
+		if !isHugepageSize(l.Pagesize) {
+			return nil, fmt.Errorf("invalid hugepage size %q", l.Pagesize)
+		}
+		key := "hugetlb." + l.Pagesize + ".max"
+		if _, exist := vals[key]; exist {
+			return nil, fmt.Errorf("duplicate hugepage limit for page size %s", l.Pagesize)
+		}
+		vals[key] = strconv.FormatUint(l.Limit, 10)
+	}
+	return vals, nil
+}
+
+// isHugepageSize returns true if the given value is a
+// number followed by one of the units KB, MB or GB.
+func isHugepageSize(s string) bool {
+	if len(s) < 3 {
+		return false
+	}
+	switch s[len(s)-2:] {
+	case "KB", "MB", "GB":
+	default:
+		return false
+	}
+	_, err := strconv.ParseUint(s[:len(s)-2], 10, 64)
+	return err == nil
+}
+
+// cpuSharesToWeight converts cgroup v1 cpu.shares [2-262144]
+// to cgroup v2 cpu.weight [1-10000].
+// The conversion is the same as the one used by runc and crun.
+// See https://github.com/kubernetes/enhancements/tree/master/keps/sig-node/2254-cgroup-v2#phase-1-convert-from-cgroups-v1-settings-to-v2
+func cpuSharesToWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	}
+	if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
 // https://kubernetes.io/docs/setup/production-environment/container-runtimes/
 // kubelet --cgroup-driver systemd --cgroups-per-qos
 // kubernetes creates the cgroup hierarchy which can be changed by serveral cgroup related flags.
@@ -276,6 +826,8 @@ func parseSystemdCgroupPath(s string) string {
 
 // killCgroup freezes the cgroups of the given container
 // and sends the given signal sig to all cgroup members.
+// The cgroup is thawed afterwards, unless it was already frozen
+// before (the container is paused).
 func killCgroup(ctx context.Context, c *Container, sig unix.Signal) error {
 	if c.CgroupDir == "" {
 		return nil
@@ -291,21 +843,57 @@ func killCgroup(ctx context.Context, c *Container, sig unix.Signal) error {
 		return nil
 	}
 
-	freezer := filepath.Join(rootDir, "cgroup.freeze")
+	// cgroup.kill (since linux 5.14) kills all processes in the cgroup tree,
+	// without the need to freeze the cgroup.
+	// It can not be used if the monitor process is a member of the container cgroup.
+	if sig == unix.SIGKILL && c.MonitorCgroupDir != "" {
+		err := writeCgroupFile(filepath.Join(rootDir, "cgroup.kill"), "1")
+		if err == nil {
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			c.Log.Warn().Msgf("failed to kill cgroup using cgroup.kill: %s", err)
+		}
+	}
+
+	// A paused container must remain frozen after the signal was delivered.
+	wasFrozen := ev.frozen
 
-	err = cgroupFreeze(freezer, true)
+	err = freezeCgroup(ctx, c, true)
 	if err != nil {
 		return err
 	}
 
-	err = pollCgroupEvents(ctx, eventsFile, func(ev cgroupEvents) bool {
-		return ev.frozen
-	})
+	pids, err := readCgroupProcs(c.Log, rootDir)
 	if err != nil {
 		return err
 	}
 
-	err = filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+	c.Log.Debug().Msgf("killing %d cgroup procs: %v", len(pids), pids)
+	for _, pid := range pids {
+		// do not kill the monitor process
+		if pid == c.Pid {
+			continue
+		}
+		err = signalCgroupProcess(pid, c.CgroupDir, sig)
+		if err != nil && err != unix.ESRCH {
+			c.Log.Error().Msgf("failed to kill %d: %s", pid, err)
+			continue
+		}
+	}
+
+	if wasFrozen {
+		return nil
+	}
+	return freezeCgroup(ctx, c, false)
+}
+
+// readCgroupProcs returns the PIDs from all cgroup.procs files
+// within the given cgroup directory and its sub cgroups.
+// Invalid PIDs are logged and skipped.
+func readCgroupProcs(log zerolog.Logger, rootDir string) ([]int, error) {
+	var pids []int
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -322,38 +910,57 @@ func killCgroup(ctx context.Context, c *Container, sig unix.Signal) error {
 		if s == "" {
 			return nil
 		}
-		vals := strings.Split(s, "\n")
-
-		c.Log.Debug().Msgf("killing %d cgroup procs: %s", len(vals), vals)
-		for _, s := range vals {
+		for _, s := range strings.Split(s, "\n") {
 			pid, err := strconv.Atoi(s)
 			if err != nil {
-				c.Log.Error().Msgf("failed to convert PID %q to number: %s", s, err)
-				continue
-			}
-			// do not kill the monitor process
-			if pid == c.Pid {
-				continue
-			}
-			err = unix.Kill(pid, sig)
-			if err != nil && err != unix.ESRCH {
-				c.Log.Error().Msgf("failed to kill %d: %s", pid, err)
+				log.Error().Msgf("failed to convert PID %q from %s to number: %s", s, path, err)
 				continue
 			}
+			pids = append(pids, pid)
 		}
 		return nil
 	})
+	return pids, err
+}
+
+// freezeCgroup freezes (or thaws) the cgroup of the given container
+// and waits until the cgroup has reached the requested state.
+func freezeCgroup(ctx context.Context, c *Container, freeze bool) error {
+	rootDir := filepath.Join(cgroupRoot, c.CgroupDir)
 
+	err := cgroupFreeze(filepath.Join(rootDir, "cgroup.freeze"), freeze)
 	if err != nil {
 		return err
 	}
 
-	err = cgroupFreeze(freezer, false)
+	return pollCgroupEvents(ctx, filepath.Join(rootDir, "cgroup.events"), func(ev cgroupEvents) bool {
+		return ev.frozen == freeze
+	})
+}
+
+// writeCgroupValues writes the given values to the
+// interface files in the given cgroup directory.
+func writeCgroupValues(dir string, vals cgroupValues) error {
+	for _, key := range vals.keys() {
+		for _, val := range strings.Split(vals[key], "\n") {
+			if err := writeCgroupFile(filepath.Join(dir, key), val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeCgroupFile(filename string, val string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	if _, err := f.Write([]byte(val)); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %q to %s: %w", val, filename, err)
+	}
+	return f.Close()
 }
 
 type cgroupEvents struct {
@@ -397,24 +1004,6 @@ func cgroupFreeze(filename string, freeze bool) error {
 	return err
 }
 
-func pollCgroupEvents(ctx context.Context, eventsFile string, fn func(ev cgroupEvents) bool) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			ev, err := parseCgroupEvents(eventsFile)
-			if err != nil {
-				return err
-			}
-			if fn(ev) {
-				return nil
-			}
-			time.Sleep(time.Millisecond * 5)
-		}
-	}
-}
-
 func deleteCgroup(cgroupName string) error {
 	return deleteCgroupRecursive(cgroupName, 0, 10)
 }
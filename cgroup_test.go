@@ -1,9 +1,17 @@
 package lxcri
 
 import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestParseSystemCgroupPath(t *testing.T) {
@@ -11,3 +19,340 @@ func TestParseSystemCgroupPath(t *testing.T) {
 	cg := parseSystemdCgroupPath(s)
 	require.Equal(t, "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-123.slice/crio-ABC.scope", cg)
 }
+
+func int64p(v int64) *int64 {
+	return &v
+}
+
+func TestMemoryValues(t *testing.T) {
+	vals, err := memoryValues(&specs.LinuxMemory{
+		Limit:       int64p(1024),
+		Reservation: int64p(512),
+		Swap:        int64p(4096),
+	})
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{
+		"memory.max":      "1024",
+		"memory.low":      "512",
+		"memory.swap.max": "3072",
+	}, vals)
+
+	vals, err = memoryValues(&specs.LinuxMemory{Limit: int64p(-1)})
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{"memory.max": "max", "memory.swap.max": "max"}, vals)
+
+	vals, err = memoryValues(&specs.LinuxMemory{Limit: int64p(1024), Swap: int64p(1024)})
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{"memory.max": "1024", "memory.swap.max": "0"}, vals)
+
+	_, err = memoryValues(&specs.LinuxMemory{Limit: int64p(1024), Swap: int64p(512)})
+	require.Error(t, err)
+
+	_, err = memoryValues(&specs.LinuxMemory{Swap: int64p(512)})
+	require.Error(t, err)
+
+	disable := true
+	_, err = memoryValues(&specs.LinuxMemory{DisableOOMKiller: &disable})
+	require.Error(t, err)
+
+	_, err = memoryValues(&specs.LinuxMemory{Kernel: int64p(1024)})
+	require.Error(t, err)
+
+	for _, swappiness := range []uint64{0, math.MaxUint64} {
+		vals, err = memoryValues(&specs.LinuxMemory{Swappiness: &swappiness})
+		require.NoError(t, err)
+		require.Empty(t, vals)
+	}
+	swappiness := uint64(60)
+	_, err = memoryValues(&specs.LinuxMemory{Swappiness: &swappiness})
+	require.Error(t, err)
+}
+
+func TestCPUValues(t *testing.T) {
+	shares := uint64(1024)
+	period := uint64(50000)
+	vals, err := cpuValues(&specs.LinuxCPU{
+		Shares: &shares,
+		Quota:  int64p(20000),
+		Period: &period,
+		Cpus:   "0-3",
+		Mems:   "0",
+	})
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{
+		"cpu.weight":  "39",
+		"cpu.max":     "20000 50000",
+		"cpuset.cpus": "0-3",
+		"cpuset.mems": "0",
+	}, vals)
+
+	vals, err = cpuValues(&specs.LinuxCPU{Quota: int64p(-1)})
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{"cpu.max": "max 100000"}, vals)
+
+	_, err = cpuValues(&specs.LinuxCPU{RealtimeRuntime: int64p(1000)})
+	require.Error(t, err)
+
+	require.Equal(t, uint64(1), cpuSharesToWeight(2))
+	require.Equal(t, uint64(10000), cpuSharesToWeight(262144))
+}
+
+func throttleDevice(major, minor int64, rate uint64) specs.LinuxThrottleDevice {
+	dev := specs.LinuxThrottleDevice{Rate: rate}
+	dev.Major = major
+	dev.Minor = minor
+	return dev
+}
+
+func TestIOValues(t *testing.T) {
+	weight := uint16(500)
+	devWeight := uint16(1000)
+	weightDevice := specs.LinuxWeightDevice{Weight: &devWeight}
+	weightDevice.Major = 8
+	blockio := &specs.LinuxBlockIO{
+		Weight:                  &weight,
+		WeightDevice:            []specs.LinuxWeightDevice{weightDevice},
+		ThrottleReadBpsDevice:   []specs.LinuxThrottleDevice{throttleDevice(8, 0, 1024)},
+		ThrottleWriteIOPSDevice: []specs.LinuxThrottleDevice{throttleDevice(8, 16, 100), throttleDevice(8, 0, 0)},
+	}
+	vals, err := ioValues(blockio)
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{
+		"io.weight": "default 4950\n8:0 10000",
+		"io.max":    "8:0 rbps=1024 wiops=max\n8:16 wiops=100",
+	}, vals)
+
+	leafWeight := uint16(100)
+	_, err = ioValues(&specs.LinuxBlockIO{LeafWeight: &leafWeight})
+	require.Error(t, err)
+}
+
+func TestHugetlbValues(t *testing.T) {
+	vals, err := hugetlbValues([]specs.LinuxHugepageLimit{
+		{Pagesize: "2MB", Limit: 4194304},
+		{Pagesize: "1GB", Limit: 0},
+	})
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{
+		"hugetlb.2MB.max": "4194304",
+		"hugetlb.1GB.max": "0",
+	}, vals)
+
+	_, err = hugetlbValues([]specs.LinuxHugepageLimit{{Pagesize: "2M"}})
+	require.Error(t, err)
+
+	_, err = hugetlbValues([]specs.LinuxHugepageLimit{{Pagesize: "../2MB"}})
+	require.Error(t, err)
+
+	_, err = hugetlbValues([]specs.LinuxHugepageLimit{{Pagesize: "2MB"}, {Pagesize: "2MB"}})
+	require.Error(t, err)
+}
+
+func TestResourceValuesUnified(t *testing.T) {
+	res := &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: int64p(1024)},
+		Unified: map[string]string{
+			"memory.max":  "2048",
+			"memory.high": "1536",
+			"cpu.idle":    "1",
+		},
+	}
+	vals, err := resourceValues(res)
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{
+		"memory.max":  "2048",
+		"memory.high": "1536",
+		"cpu.idle":    "1",
+	}, vals)
+
+	for _, key := range []string{"../memory.max", "foo/memory.max", "memory", ".max", "memory.", "cgroup.procs"} {
+		res.Unified = map[string]string{key: "1"}
+		_, err = resourceValues(res)
+		require.Error(t, err, key)
+	}
+}
+
+func TestResourceValuesPids(t *testing.T) {
+	for limit, expected := range map[int64]string{-1: "max", 0: "max", 10: "10"} {
+		vals, err := resourceValues(&specs.LinuxResources{Pids: &specs.LinuxPids{Limit: limit}})
+		require.NoError(t, err)
+		require.Equal(t, cgroupValues{"pids.max": expected}, vals)
+	}
+}
+
+func TestMergeResources(t *testing.T) {
+	res := &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: int64p(1024), Swap: int64p(4096)},
+		Pids:   &specs.LinuxPids{Limit: 10},
+		Unified: map[string]string{
+			"memory.high": "512",
+			"pids.max":    "20",
+		},
+	}
+	update := &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: int64p(2048)},
+	}
+
+	merged, changed := mergeResources(res, update)
+	require.Equal(t, int64(2048), *merged.Memory.Limit)
+	require.Equal(t, int64(4096), *merged.Memory.Swap)
+	require.Equal(t, res.Pids, merged.Pids)
+	require.Equal(t, res.Unified, merged.Unified)
+	// the given resources are not modified
+	require.Equal(t, int64(1024), *res.Memory.Limit)
+
+	vals, err := resourceValues(changed)
+	require.NoError(t, err)
+	require.Equal(t, cgroupValues{
+		"memory.max":      "2048",
+		"memory.swap.max": "2048",
+		"memory.high":     "512",
+	}, vals)
+}
+
+func TestReadCgroupStats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"cpu.stat":            "usage_usec 1200\nuser_usec 1000\nsystem_usec 200\nnr_periods 10\nnr_throttled 2\nthrottled_usec 50\n",
+		"cpu.pressure":        "some avg10=1.50 avg60=0.20 avg300=0.00 total=1234\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"memory.current":      "4096\n",
+		"memory.max":          "8192\n",
+		"memory.swap.current": "0\n",
+		"memory.swap.max":     "max\n",
+		"memory.stat":         "anon 1024\nfile 2048\n",
+		"memory.events":       "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+		"pids.current":        "5\n",
+		"pids.max":            "max\n",
+		"io.stat":             "8:0 rbytes=100 wbytes=200 rios=1 wios=2 dbytes=0 dios=0\n",
+	}
+	for name, data := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		require.NoError(t, err)
+	}
+
+	stats, err := readCgroupStats(dir)
+	require.NoError(t, err)
+
+	require.Equal(t, CPUUsage{Total: 1200000, User: 1000000, Kernel: 200000}, stats.CPU.Usage)
+	require.Equal(t, Throttling{Periods: 10, ThrottledPeriods: 2, ThrottledTime: 50000}, stats.CPU.Throttling)
+	require.NotNil(t, stats.CPU.PSI)
+	require.Equal(t, PSIData{Avg10: 1.5, Avg60: 0.2, Total: 1234}, stats.CPU.PSI.Some)
+
+	require.Equal(t, MemoryEntry{Usage: 4096, Limit: 8192, Failcnt: 3}, stats.Memory.Usage)
+	require.Equal(t, MemoryEntry{Usage: 4096, Limit: math.MaxUint64}, stats.Memory.Swap)
+	require.Equal(t, uint64(2048), stats.Memory.Cache)
+	require.Nil(t, stats.Memory.PSI)
+
+	require.Equal(t, PidsStats{Current: 5}, stats.Pids)
+
+	require.Equal(t, []BlkioEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 100},
+		{Major: 8, Minor: 0, Op: "Write", Value: 200},
+		{Major: 8, Minor: 0, Op: "Discard", Value: 0},
+	}, stats.Blkio.IoServiceBytesRecursive)
+	require.Len(t, stats.Blkio.IoServicedRecursive, 3)
+}
+
+func TestReadCgroupStatsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "pids.current"), []byte("abc\n"), 0644)
+	require.NoError(t, err)
+	_, err = readCgroupStats(dir)
+	require.Error(t, err)
+}
+
+func TestContainerEvents(t *testing.T) {
+	root := cgroupRoot
+	defer func() { cgroupRoot = root }()
+	cgroupRoot = t.TempDir()
+
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "test", CgroupDir: "test"}}
+	dir := filepath.Join(cgroupRoot, c.CgroupDir)
+	require.NoError(t, os.Mkdir(dir, 0755))
+
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	write("cgroup.events", "populated 1\nfrozen 0\n")
+	write("memory.events", "oom 0\noom_kill 0\n")
+
+	var events []Event
+	err := c.Events(context.Background(), time.Hour, func(ev Event) error {
+		events = append(events, ev)
+		switch len(events) {
+		case 1:
+			write("memory.events", "oom 1\noom_kill 1\n")
+		case 2:
+			write("cgroup.events", "populated 1\nfrozen 1\n")
+		case 3:
+			write("cgroup.events", "populated 0\nfrozen 0\n")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []Event{
+		{Type: EventTypeState, ID: "test", Data: CgroupState{Populated: true}},
+		{Type: EventTypeOOM, ID: "test"},
+		{Type: EventTypeState, ID: "test", Data: CgroupState{Populated: true, Frozen: true}},
+		{Type: EventTypeState, ID: "test", Data: CgroupState{}},
+	}, events)
+}
+
+func TestReadCgroupProcs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte("1\n20\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "cgroup.procs"), []byte("300\ninvalid\n"), 0644))
+
+	pids, err := readCgroupProcs(zerolog.Nop(), dir)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 20, 300}, pids)
+}
+
+func TestReadProcess(t *testing.T) {
+	dir := t.TempDir()
+	pdir := filepath.Join(dir, "42")
+	require.NoError(t, os.Mkdir(pdir, 0755))
+	status := "Name:\tsleep\nState:\tS (sleeping)\nPid:\t42\nNSpid:\t42\t7\n"
+	require.NoError(t, os.WriteFile(filepath.Join(pdir, "status"), []byte(status), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(pdir, "cmdline"), []byte("sleep\x00infinity\x00"), 0644))
+
+	p, err := readProcess(dir, 42)
+	require.NoError(t, err)
+	require.Equal(t, Process{PID: 42, NSpid: []int{42, 7}, Command: "sleep infinity"}, p)
+	require.Equal(t, 7, p.ContainerPID())
+
+	require.NoError(t, os.WriteFile(filepath.Join(pdir, "cmdline"), nil, 0644))
+	p, err = readProcess(dir, 42)
+	require.NoError(t, err)
+	require.Equal(t, "[sleep]", p.Command)
+}
+
+func TestKillCgroupKillFile(t *testing.T) {
+	root := cgroupRoot
+	defer func() { cgroupRoot = root }()
+	cgroupRoot = t.TempDir()
+
+	c := &Container{ContainerConfig: &ContainerConfig{
+		ContainerID: "test", CgroupDir: "test", MonitorCgroupDir: "monitor/test.scope",
+		Log: zerolog.Nop(),
+	}}
+	dir := filepath.Join(cgroupRoot, c.CgroupDir)
+	require.NoError(t, os.Mkdir(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 1\nfrozen 0\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.kill"), nil, 0644))
+
+	// The cgroup is not frozen (cgroup.freeze does not exist) if cgroup.kill is used.
+	require.NoError(t, killCgroup(context.Background(), c, unix.SIGKILL))
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.kill"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(data))
+
+	// cgroup.kill must not be used if the monitor might be a member of the container cgroup.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.kill"), nil, 0644))
+	c.MonitorCgroupDir = ""
+	require.Error(t, killCgroup(context.Background(), c, unix.SIGKILL))
+	data, err = os.ReadFile(filepath.Join(dir, "cgroup.kill"))
+	require.NoError(t, err)
+	require.Empty(t, data)
+}
@@ -24,6 +24,7 @@ func main() {
 	var timeout int
 	// Individual hooks should set a timeout lower than the overall timeout.
 	flag.IntVar(&timeout, "timeout", 30, "maximum run time in seconds allowed for all hooks")
+	flag.StringVar(&memoryEvents, "memory-events", "", "path to the memory.events file of the container cgroup (stop hook only)")
 	flag.Parse()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
@@ -42,9 +43,16 @@ func main() {
 	}
 }
 
+// memoryEvents is the memory.events file of the container cgroup.
+var memoryEvents string
+
 func run(ctx context.Context, env *Env) error {
 	runtimeDir := filepath.Dir(env.ConfigFile)
 
+	if env.Type == HookStop {
+		return saveMemoryEvents(runtimeDir)
+	}
+
 	var hooks specs.Hooks
 	err := specki.DecodeJSONFile(filepath.Join(runtimeDir, "hooks.json"), &hooks)
 	if err != nil {
@@ -72,6 +80,23 @@ func run(ctx context.Context, env *Env) error {
 	return specki.RunHooks(ctx, &state, hooksToRun, false)
 }
 
+// saveMemoryEvents copies the memory.events file of the container cgroup
+// to the runtime directory. The liblxc stop hook runs before the container
+// cgroup is destroyed, and the runtime uses the copy to detect OOM kills.
+func saveMemoryEvents(runtimeDir string) error {
+	if memoryEvents == "" {
+		return nil
+	}
+	data, err := os.ReadFile(memoryEvents)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(runtimeDir, "memory.events"), data, 0440)
+}
+
 // https://github.com/opencontainers/runtime-spec/blob/master/specs-go/state.go
 // The only value that does change is the specs.ContainerState in specs.State.Status.
 // The specs.ContainerState is implied by the runtime hook.
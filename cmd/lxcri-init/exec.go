@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultPath is the search path used by execvp if PATH is not set.
+const defaultPath = "/bin:/usr/bin"
+
+// doExec executes a process attached to the container by the runtime
+// and reports exec errors to the runtime.
+// It is called as `lxcri-init exec [-syncfd <fd>] [-no-new-privs] <errfd> <cmd> [args...]`.
+// <errfd> is the write end of the error pipe created by the runtime.
+// A started message is written to the pipe when lxcri-init is started,
+// followed by an error message if the exec fails (see writeMessage).
+// The pipe is closed on exec.
+// If -syncfd is set, lxcri-init waits after the started message until the runtime
+// writes a single byte to the sync pipe. The runtime uses this to apply
+// the resource limits and the OOM score before the process is executed.
+// The exit codes for a failed exec match the exit codes of liblxc.
+func doExec(args []string) {
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	syncFd := flags.Int("syncfd", -1, "read end of the sync pipe")
+	noNewPrivs := flags.Bool("no-new-privs", false, "set no_new_privs for the process")
+	if err := flags.Parse(args); err != nil {
+		os.Exit(126)
+	}
+	args = flags.Args()
+
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: lxcri-init exec [-syncfd <fd>] [-no-new-privs] <errfd> <cmd> [args...]")
+		os.Exit(126)
+	}
+	fd, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid error pipe fd %q\n", args[0])
+		os.Exit(126)
+	}
+	unix.CloseOnExec(fd)
+	writeMessage(fd, msgStarted, "")
+
+	if *syncFd >= 0 {
+		unix.CloseOnExec(*syncFd)
+		if err := waitSync(*syncFd); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(126)
+		}
+	}
+	if *noNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to set no_new_privs: %s\n", err)
+			os.Exit(126)
+		}
+	}
+
+	errno := execvp(args[1], args[1:], os.Environ())
+	writeMessage(fd, msgError, strconv.Itoa(int(errno)))
+	fmt.Fprintf(os.Stderr, "failed to exec %q: %s\n", args[1], errno)
+	if errno == unix.ENOENT {
+		os.Exit(127)
+	}
+	os.Exit(126)
+}
+
+// Message types written to the error pipe.
+// The values must match the values used by the runtime.
+const (
+	msgStarted = 's'
+	msgError   = 'e'
+)
+
+// writeMessage writes a message to the error pipe fd.
+// A message is the message type byte followed by
+// the payload length byte and the payload.
+func writeMessage(fd int, typ byte, payload string) {
+	if len(payload) > 255 {
+		payload = payload[:255]
+	}
+	msg := append([]byte{typ, byte(len(payload))}, payload...)
+	// #nosec
+	unix.Write(fd, msg)
+}
+
+// waitSync blocks until the runtime writes a single byte to the sync pipe fd.
+// The runtime closes the pipe without writing if the process must not be executed.
+func waitSync(fd int) error {
+	buf := make([]byte, 1)
+	for {
+		n, err := unix.Read(fd, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read sync pipe: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("sync pipe was closed by the runtime")
+		}
+		return nil
+	}
+}
+
+// execvp executes the file like execvp(3) and returns the error
+// if the exec failed. If file does not contain a slash
+// the file is searched in the directories from the PATH environment variable.
+func execvp(file string, args []string, env []string) unix.Errno {
+	if strings.ContainsRune(file, '/') {
+		return execve(file, args, env)
+	}
+
+	path, ok := os.LookupEnv("PATH")
+	if !ok {
+		path = defaultPath
+	}
+	errno := unix.ENOENT
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		err := execve(filepath.Join(dir, file), args, env)
+		switch err {
+		case unix.EACCES:
+			// Continue the search, but report EACCES if no executable is found.
+			errno = unix.EACCES
+		case unix.ENOENT, unix.ENOTDIR, unix.ESTALE, unix.ENODEV, unix.ETIMEDOUT:
+		default:
+			return err
+		}
+	}
+	return errno
+}
+
+func execve(file string, args []string, env []string) unix.Errno {
+	err := unix.Exec(file, args, env)
+	if errno, ok := err.(unix.Errno); ok {
+		return errno
+	}
+	return unix.EINVAL
+}
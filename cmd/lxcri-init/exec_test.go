@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestExecvp(t *testing.T) {
+	dir := t.TempDir()
+	noexec := filepath.Join(dir, "noexec")
+	require.NoError(t, os.WriteFile(noexec, []byte("#!/bin/sh\n"), 0644))
+
+	env := os.Environ()
+	require.Equal(t, unix.ENOENT, execvp(filepath.Join(dir, "missing"), []string{"missing"}, env))
+	require.Equal(t, unix.EACCES, execvp(noexec, []string{"noexec"}, env))
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+
+	require.NoError(t, os.Setenv("PATH", dir))
+	require.Equal(t, unix.ENOENT, execvp("missing", []string{"missing"}, env))
+
+	// EACCES is reported if the file is not found in a later path element.
+	require.NoError(t, os.Setenv("PATH", dir+":"+filepath.Join(dir, "other")))
+	require.Equal(t, unix.EACCES, execvp("noexec", []string{"noexec"}, env))
+}
+
+func TestWaitSync(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = w.Write([]byte{0})
+	require.NoError(t, err)
+	require.NoError(t, waitSync(int(r.Fd())))
+
+	require.NoError(t, w.Close())
+	require.Error(t, waitSync(int(r.Fd())))
+}
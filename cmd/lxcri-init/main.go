@@ -15,6 +15,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "exec" {
+		doExec(os.Args[2:])
+	}
+
 	// TODO use environment variable for runtime dir
 	runtimeDir, err := os.Getwd()
 	if err != nil {
@@ -26,6 +30,7 @@ func main() {
 	spec, err := specki.LoadSpecJSON(specPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		writeInitError(runtimeDir, err)
 		os.Exit(3)
 	}
 
@@ -35,10 +40,47 @@ func main() {
 			fmt.Fprintf(os.Stderr, "%s", err)
 		}
 		fmt.Fprintf(os.Stderr, "init failed: %s\n", err)
+		writeInitError(runtimeDir, err)
 		os.Exit(4)
 	}
 }
 
+// maxInitErrorSize is the maximum size of the reported init error.
+// It must match the value used by the runtime.
+const maxInitErrorSize = 4096
+
+// syncFifo is the read end of the sync fifo.
+// It is -1 until the runtime has opened the write end.
+var syncFifo = -1
+
+// writeInitError reports the init error to the runtime over the sync fifo.
+// If the runtime has not opened the fifo yet, it blocks until the container
+// is started, so that the error is reported by the start command.
+// The message is written while the read end is still open
+// and is read by the runtime after lxcri-init has exited.
+func writeInitError(runtimeDir string, initErr error) {
+	filename := filepath.Join(runtimeDir, "syncfifo")
+	if syncFifo < 0 {
+		if err := readSyncfifo(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to report init error: %s\n", err)
+			return
+		}
+	}
+	fd, err := unix.Open(filename, unix.O_WRONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open %s: %s\n", filename, err)
+		return
+	}
+	defer unix.Close(fd)
+	msg := []byte(initErr.Error())
+	if len(msg) > maxInitErrorSize {
+		msg = msg[:maxInitErrorSize]
+	}
+	if _, err := unix.Write(fd, msg); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write init error: %s\n", err)
+	}
+}
+
 func writeTerminationLog(spec *specs.Spec, format string, a ...interface{}) error {
 	var terminationLog string
 	if spec.Annotations != nil {
@@ -104,19 +146,22 @@ func doInit(runtimeDir string, spec *specs.Spec) error {
 		return err
 	}
 
-	unix.Exec(cmdPath, spec.Process.Args, spec.Process.Env)
-	if err != nil {
-		return fmt.Errorf("exec failed: %w", err)
-	}
-	return nil
+	// Exec only returns if it failed.
+	err = unix.Exec(cmdPath, spec.Process.Args, spec.Process.Env)
+	return fmt.Errorf("exec failed: %w", err)
 }
 
+// readSyncfifo blocks until the runtime opens the sync fifo for writing.
+// The read end is kept open and closed on exec (O_CLOEXEC).
+// The runtime polls the write end to detect that the container process was executed.
+// A raw file descriptor is used, because the finalizer of os.File would close it.
 func readSyncfifo(filename string) error {
-	f, err := os.OpenFile(filename, os.O_RDONLY, 0)
+	fd, err := unix.Open(filename, unix.O_RDONLY|unix.O_CLOEXEC, 0)
 	if err != nil {
 		return fmt.Errorf("failed to open %s: %w", filename, err)
 	}
-	return f.Close()
+	syncFifo = fd
+	return nil
 }
 
 /*
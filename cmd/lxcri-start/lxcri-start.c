@@ -1,10 +1,14 @@
 #define _GNU_SOURCE
 #include <errno.h>
 #include <fcntl.h>
+#include <libgen.h>
+#include <limits.h>
 #include <signal.h>
 #include <stdio.h>
+#include <stdlib.h>
 #include <string.h>
 #include <sys/types.h>
+#include <time.h>
 #include <unistd.h>
 
 #include <lxc/lxccontainer.h>
@@ -22,6 +26,54 @@
 		goto out;                                                   \
 	}
 
+/*
+/ Record the wait status of the container init process and the time it finished
+/ in the file 'exitstatus' within the runtime directory (the directory of rcfile).
+/ The file is written only once and parsed by the runtime (see exit.go).
+*/
+static void write_exit_status(const char *rcfile, int status)
+{
+	char *dir = NULL;
+	char path[PATH_MAX];
+	struct timespec ts;
+	FILE *f = NULL;
+	int fd;
+
+	if (clock_gettime(CLOCK_REALTIME, &ts) == -1) {
+		fprintf(stderr, "[lxcri-start] failed to get time: %s\n", strerror(errno));
+		return;
+	}
+
+	dir = strdup(rcfile);
+	if (dir == NULL)
+		return;
+
+	if (snprintf(path, sizeof(path), "%s/exitstatus", dirname(dir)) >= (int)sizeof(path)) {
+		fprintf(stderr, "[lxcri-start] exit status path is too long\n");
+		goto out;
+	}
+
+	fd = open(path, O_WRONLY | O_CREAT | O_EXCL | O_CLOEXEC, 0440);
+	if (fd == -1) {
+		fprintf(stderr, "[lxcri-start] failed to create %s: %s\n", path, strerror(errno));
+		goto out;
+	}
+
+	f = fdopen(fd, "w");
+	if (f == NULL) {
+		close(fd);
+		goto out;
+	}
+
+	/* <wait status> <finish time seconds> <finish time nanoseconds> */
+	if (fprintf(f, "%d %lld %ld\n", status, (long long)ts.tv_sec, ts.tv_nsec) < 0)
+		fprintf(stderr, "[lxcri-start] failed to write %s\n", path);
+
+	fclose(f);
+out:
+	free(dir);
+}
+
 /* NOTE lxc_execute.c was taken as guidline and some lines where copied. */
 int main(int argc, char **argv)
 {
@@ -67,6 +119,8 @@ int main(int argc, char **argv)
 	if (!c->start(c, ENABLE_LXCINIT, NULL))
 		ERROR("monitor process pid=%d failed (container error_num:%d)\n", getpid(), c->error_num);
 
+	write_exit_status(rcfile, c->error_num);
+
 	/* Try to die with the same signal the task did. */
 	/* FIXME error_num is zero if init was killed with SIGHUP */
 	if (WIFSIGNALED(c->error_num))
@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 	"text/template"
 	"time"
 
@@ -15,6 +18,7 @@ import (
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/sys/unix"
 	"sigs.k8s.io/yaml"
 )
 
@@ -51,7 +55,11 @@ type timeouts struct {
 	CreateTimeout uint `json:",omitempty"`
 	StartTimeout  uint `json:",omitempty"`
 	KillTimeout   uint `json:",omitempty"`
+	StopTimeout   uint `json:",omitempty"`
 	DeleteTimeout uint `json:",omitempty"`
+	PauseTimeout  uint `json:",omitempty"`
+	ResumeTimeout uint `json:",omitempty"`
+	LockTimeout   uint `json:",omitempty"`
 }
 
 var defaultApp = app{
@@ -77,7 +85,11 @@ var defaultApp = app{
 		CreateTimeout: 60,
 		StartTimeout:  30,
 		KillTimeout:   10,
+		StopTimeout:   10,
 		DeleteTimeout: 10,
+		PauseTimeout:  10,
+		ResumeTimeout: 10,
+		LockTimeout:   10,
 	},
 }
 
@@ -117,6 +129,19 @@ func (app *app) loadContainer(containerID string) (*lxcri.Container, error) {
 	return c, err
 }
 
+// lockContainer acquires the lock for the container in the given mode.
+func (app *app) lockContainer(mode lxcri.LockMode) (*lxcri.Lock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(app.Timeouts.LockTimeout)*time.Second)
+	defer cancel()
+	return app.Lock(ctx, app.containerID, mode)
+}
+
+func (app *app) unlockContainer(l *lxcri.Lock) {
+	if err := l.Unlock(); err != nil {
+		app.Runtime.Log.Error().Msgf("failed to release container lock: %s", err)
+	}
+}
+
 func (app *app) releaseContainer(c *lxcri.Container) {
 	if c == nil {
 		return
@@ -165,9 +190,19 @@ func main() {
 		&stateCmd,
 		&createCmd,
 		&startCmd,
+		&runCmd,
 		&killCmd,
+		&stopCmd,
+		&pauseCmd,
+		&resumeCmd,
+		&updateCmd,
+		&statsCmd,
+		&eventsCmd,
+		&psCmd,
 		&deleteCmd,
+		&gcCmd,
 		&execCmd,
+		&execListCmd,
 		&inspectCmd,
 		&listCmd,
 		&configCmd,
@@ -294,6 +329,13 @@ func main() {
 			Value:       clxc.Timeouts.KillTimeout,
 			Destination: &clxc.Timeouts.KillTimeout,
 		},
+		&cli.UintFlag{
+			Name:        "stop-timeout",
+			Usage:       "maximum duration in seconds for the container to stop before it is killed",
+			EnvVars:     []string{"LXCRI_STOP_TIMEOUT"},
+			Value:       clxc.Timeouts.StopTimeout,
+			Destination: &clxc.Timeouts.StopTimeout,
+		},
 		&cli.UintFlag{
 			Name:        "delete-timeout",
 			Usage:       "maximum duration in seconds for delete to complete",
@@ -301,6 +343,27 @@ func main() {
 			Value:       clxc.Timeouts.DeleteTimeout,
 			Destination: &clxc.Timeouts.DeleteTimeout,
 		},
+		&cli.UintFlag{
+			Name:        "pause-timeout",
+			Usage:       "maximum duration in seconds for pause to complete",
+			EnvVars:     []string{"LXCRI_PAUSE_TIMEOUT"},
+			Value:       clxc.Timeouts.PauseTimeout,
+			Destination: &clxc.Timeouts.PauseTimeout,
+		},
+		&cli.UintFlag{
+			Name:        "resume-timeout",
+			Usage:       "maximum duration in seconds for resume to complete",
+			EnvVars:     []string{"LXCRI_RESUME_TIMEOUT"},
+			Value:       clxc.Timeouts.ResumeTimeout,
+			Destination: &clxc.Timeouts.ResumeTimeout,
+		},
+		&cli.UintFlag{
+			Name:        "lock-timeout",
+			Usage:       "maximum duration in seconds to wait for the container lock",
+			EnvVars:     []string{"LXCRI_LOCK_TIMEOUT"},
+			Value:       clxc.Timeouts.LockTimeout,
+			Destination: &clxc.Timeouts.LockTimeout,
+		},
 	}
 
 	startTime := time.Now()
@@ -326,11 +389,13 @@ func main() {
 		if clxc.command == "list" || clxc.command == "config" {
 			return nil
 		}
-		containerID := ctx.Args().Get(0)
-		if len(containerID) == 0 {
-			return fmt.Errorf("missing container ID")
+		if clxc.command != "gc" {
+			containerID := ctx.Args().Get(0)
+			if len(containerID) == 0 {
+				return fmt.Errorf("missing container ID")
+			}
+			clxc.containerID = containerID
 		}
-		clxc.containerID = containerID
 
 		if err := clxc.configureLogger(); err != nil {
 			return fmt.Errorf("failed to configure logger: %w", err)
@@ -354,9 +419,9 @@ func main() {
 		println(err.Error())
 
 		// exit with exit status of executed command
-		var errExec execError
-		if errors.As(err, &errExec) {
-			os.Exit(errExec.exitStatus())
+		var errExit interface{ exitStatus() int }
+		if errors.As(err, &errExit) {
+			os.Exit(errExit.exitStatus())
 		}
 		os.Exit(1)
 	}
@@ -418,6 +483,10 @@ func doCreate(ctxcli *cli.Context) error {
 		return fmt.Errorf("failed to load container spec from bundle: %w", err)
 	}
 	cfg.Spec = spec
+	cfg.TimeOffsets, err = loadTimeOffsets(specPath)
+	if err != nil {
+		return fmt.Errorf("failed to load time offsets from bundle: %w", err)
+	}
 	pidFile := ctxcli.String("pid-file")
 
 	timeout := time.Duration(clxc.Timeouts.CreateTimeout) * time.Second
@@ -477,7 +546,15 @@ func doStart(ctxcli *cli.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	if err := doStartInternal(ctx); err != nil {
+	lock, err := clxc.lockContainer(lxcri.LockExclusive)
+	if err != nil {
+		return err
+	}
+	err = doStartInternal(ctx)
+	// Delete acquires the lock itself.
+	clxc.unlockContainer(lock)
+
+	if err != nil {
 		//  a new context because start may fail with a timeout.
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clxc.Timeouts.DeleteTimeout)*time.Second)
 		defer cancel()
@@ -489,6 +566,8 @@ func doStart(ctxcli *cli.Context) error {
 	return nil
 }
 
+// doStartInternal starts the container.
+// The caller must hold the container lock in exclusive mode.
 func doStartInternal(ctx context.Context) error {
 	c, err := clxc.loadContainer(clxc.containerID)
 	if err != nil {
@@ -498,6 +577,101 @@ func doStartInternal(ctx context.Context) error {
 	return clxc.Start(ctx, c)
 }
 
+var runCmd = cli.Command{
+	Name:      "run",
+	Usage:     "creates and starts a container and waits for the container process to exit",
+	ArgsUsage: "<containerID>",
+	Action:    doRun,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "bundle",
+			Usage: "set bundle directory",
+			Value: ".",
+		},
+		&cli.StringFlag{
+			Name:  "console-socket",
+			Usage: "send container pty master fd to this socket path",
+		},
+		&cli.StringFlag{
+			Name:  "pid-file",
+			Usage: "path to write container PID",
+		},
+		&cli.BoolFlag{
+			Name:  "keep",
+			Usage: "do not delete the container after it exited",
+		},
+	},
+}
+
+// exitCodeError is returned by `run` if the container process
+// exited with a non-zero exit code.
+type exitCodeError int
+
+func (e exitCodeError) exitStatus() int {
+	return int(e)
+}
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("container process exited with status %d", int(e))
+}
+
+func doRun(ctxcli *cli.Context) (err error) {
+	// Signals received before the container is started
+	// are forwarded when the container is started.
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, unix.SIGINT, unix.SIGTERM, unix.SIGHUP)
+	defer signal.Stop(sigs)
+
+	// create and start delete the container if they fail.
+	if err := doCreate(ctxcli); err != nil {
+		return err
+	}
+	if err := doStart(ctxcli); err != nil {
+		return err
+	}
+
+	if !ctxcli.Bool("keep") {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clxc.Timeouts.DeleteTimeout)*time.Second)
+			defer cancel()
+			if derr := clxc.Delete(ctx, clxc.containerID, true); derr != nil {
+				clxc.Log.Error().Err(derr).Msg("failed to delete container")
+				if err == nil {
+					err = derr
+				}
+			}
+		}()
+	}
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	go func() {
+		for sig := range sigs {
+			clxc.Log.Info().Stringer("signal", sig).Msg("forward signal to container")
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clxc.Timeouts.KillTimeout)*time.Second)
+			if err := clxc.Kill(ctx, c, sig.(unix.Signal)); err != nil {
+				clxc.Log.Warn().Err(err).Stringer("signal", sig).Msg("failed to forward signal")
+			}
+			cancel()
+		}
+	}()
+
+	status, err := clxc.Wait(context.Background(), c)
+	if err != nil {
+		return err
+	}
+	clxc.Log.Info().Int("exitCode", status.ExitCode).Str("reason", status.Reason).Msg("container process exited")
+
+	if status.ExitCode != 0 {
+		return exitCodeError(status.ExitCode)
+	}
+	return nil
+}
+
 var stateCmd = cli.Command{
 	Name:   "state",
 	Usage:  "returns state of a container",
@@ -510,6 +684,12 @@ var stateCmd = cli.Command{
 }
 
 func doState(unused *cli.Context) error {
+	lock, err := clxc.lockContainer(lxcri.LockShared)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
 	c, err := clxc.loadContainer(clxc.containerID)
 	if err != nil {
 		return err
@@ -530,7 +710,7 @@ func doState(unused *cli.Context) error {
 
 var killCmd = cli.Command{
 	Name:   "kill",
-	Usage:  "sends a signal to a container",
+	Usage:  "sends a signal to the container init process",
 	Action: doKill,
 	ArgsUsage: `[containerID] [signal]
 
@@ -545,29 +725,361 @@ var killCmd = cli.Command{
 			Value:       clxc.Timeouts.KillTimeout,
 			Destination: &clxc.Timeouts.KillTimeout,
 		},
+		&cli.BoolFlag{
+			Name:    "all",
+			Aliases: []string{"a"},
+			Usage:   "send the signal to all processes in the container",
+		},
+		&cli.StringFlag{
+			Name:  "exec",
+			Usage: "send the signal to the process of the exec session with the given `ID`",
+		},
 	},
 }
 
 func doKill(ctxcli *cli.Context) error {
 	sig := ctxcli.Args().Get(1)
-	signum := parseSignal(sig)
+	signum := lxcri.ParseSignal(sig)
 	if signum == 0 {
 		return fmt.Errorf("invalid signal param %q", sig)
 	}
 
+	lock, err := clxc.lockContainer(lxcri.LockShared)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
 	c, err := clxc.loadContainer(clxc.containerID)
 	if err != nil {
 		return err
 	}
 	defer clxc.releaseContainer(c)
 
+	if execID := ctxcli.String("exec"); execID != "" {
+		if ctxcli.Bool("all") {
+			return fmt.Errorf("--all and --exec are mutually exclusive")
+		}
+		return c.SignalExec(execID, signum)
+	}
+
 	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	if ctxcli.Bool("all") {
+		return clxc.KillAll(ctx, c, signum)
+	}
 	return clxc.Kill(ctx, c, signum)
 }
 
+var stopCmd = cli.Command{
+	Name:  "stop",
+	Usage: "stops a container with the stop signal and kills it after the timeout",
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to stop
+`,
+	Action: doStop,
+	Flags: []cli.Flag{
+		&cli.UintFlag{
+			Name:        "timeout",
+			Usage:       "maximum duration in seconds for the container to stop before it is killed",
+			EnvVars:     []string{"LXCRI_STOP_TIMEOUT"},
+			Value:       clxc.Timeouts.StopTimeout,
+			Destination: &clxc.Timeouts.StopTimeout,
+		},
+	},
+}
+
+func doStop(ctxcli *cli.Context) error {
+	lock, err := clxc.lockContainer(lxcri.LockShared)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	timeout := time.Duration(clxc.Timeouts.StopTimeout) * time.Second
+	// the container is killed after the stop timeout
+	killTimeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+killTimeout)
+	defer cancel()
+
+	return clxc.Stop(ctx, c, timeout)
+}
+
+var pauseCmd = cli.Command{
+	Name:   "pause",
+	Usage:  "pauses all processes of a container",
+	Action: doPause,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to pause
+`,
+	Flags: []cli.Flag{
+		&cli.UintFlag{
+			Name:        "timeout",
+			Usage:       "maximum duration in seconds for pause to complete",
+			EnvVars:     []string{"LXCRI_PAUSE_TIMEOUT"},
+			Value:       clxc.Timeouts.PauseTimeout,
+			Destination: &clxc.Timeouts.PauseTimeout,
+		},
+	},
+}
+
+func doPause(ctxcli *cli.Context) error {
+	lock, err := clxc.lockContainer(lxcri.LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	timeout := time.Duration(clxc.Timeouts.PauseTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return clxc.Pause(ctx, c)
+}
+
+var resumeCmd = cli.Command{
+	Name:   "resume",
+	Usage:  "resumes all processes of a paused container",
+	Action: doResume,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to resume
+`,
+	Flags: []cli.Flag{
+		&cli.UintFlag{
+			Name:        "timeout",
+			Usage:       "maximum duration in seconds for resume to complete",
+			EnvVars:     []string{"LXCRI_RESUME_TIMEOUT"},
+			Value:       clxc.Timeouts.ResumeTimeout,
+			Destination: &clxc.Timeouts.ResumeTimeout,
+		},
+	},
+}
+
+func doResume(ctxcli *cli.Context) error {
+	lock, err := clxc.lockContainer(lxcri.LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	timeout := time.Duration(clxc.Timeouts.ResumeTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return clxc.Resume(ctx, c)
+}
+
+var updateCmd = cli.Command{
+	Name:   "update",
+	Usage:  "updates the resource limits of a container",
+	Action: doUpdate,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to update
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "resources",
+			Aliases:  []string{"r"},
+			Usage:    "path to the JSON encoded linux resources to update, or '-' to read from stdin",
+			Required: true,
+		},
+	},
+}
+
+func doUpdate(ctxcli *cli.Context) error {
+	resources := new(specs.LinuxResources)
+	src := ctxcli.String("resources")
+	if src == "-" {
+		if err := json.NewDecoder(os.Stdin).Decode(resources); err != nil {
+			return fmt.Errorf("failed to decode resources from stdin: %w", err)
+		}
+	} else {
+		if err := specki.DecodeJSONFile(src, resources); err != nil {
+			return err
+		}
+	}
+
+	lock, err := clxc.lockContainer(lxcri.LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	return clxc.Update(context.Background(), c, resources)
+}
+
+var statsCmd = cli.Command{
+	Name:   "stats",
+	Usage:  "prints the cgroup resource usage statistics of a container",
+	Action: doStats,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container
+`,
+	Flags: []cli.Flag{},
+}
+
+func doStats(unused *cli.Context) error {
+	lock, err := clxc.lockContainer(lxcri.LockShared)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	stats, err := c.Stats()
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(lxcri.Event{Type: lxcri.EventTypeStats, ID: c.ContainerID, Data: stats})
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(j))
+	return err
+}
+
+var eventsCmd = cli.Command{
+	Name:   "events",
+	Usage:  "prints container events as JSON lines until the container exits",
+	Action: doEvents,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container
+`,
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "interval",
+			Usage: "interval for emitting stats events, 0 disables stats events",
+			Value: time.Second * 5,
+		},
+	},
+}
+
+func doEvents(ctxcli *cli.Context) error {
+	lock, err := clxc.lockContainer(lxcri.LockShared)
+	if err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	// The lock is not held while streaming events,
+	// because it would block delete until the container has stopped.
+	clxc.unlockContainer(lock)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	enc := json.NewEncoder(os.Stdout)
+	return c.Events(context.Background(), ctxcli.Duration("interval"), func(ev lxcri.Event) error {
+		clxc.Log.Debug().Str("type", ev.Type).Msg("container event")
+		return enc.Encode(ev)
+	})
+}
+
+var psCmd = cli.Command{
+	Name:   "ps",
+	Usage:  "lists the processes running inside a container",
+	Action: doPs,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format (table|json)",
+			Value: "table",
+		},
+		&cli.BoolFlag{
+			Name:  "nspid",
+			Usage: "show the process IDs within the container PID namespace",
+		},
+	},
+}
+
+func doPs(ctxcli *cli.Context) error {
+	format := ctxcli.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %q", format)
+	}
+
+	lock, err := clxc.lockContainer(lxcri.LockShared)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	procs, err := c.Processes()
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		if !ctxcli.Bool("nspid") {
+			for i := range procs {
+				procs[i].NSpid = nil
+			}
+		}
+		return json.NewEncoder(os.Stdout).Encode(procs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if ctxcli.Bool("nspid") {
+		fmt.Fprintln(w, "PID\tNSPID\tCMD")
+		for _, p := range procs {
+			fmt.Fprintf(w, "%d\t%d\t%s\n", p.PID, p.ContainerPID(), p.Command)
+		}
+	} else {
+		fmt.Fprintln(w, "PID\tCMD")
+		for _, p := range procs {
+			fmt.Fprintf(w, "%d\t%s\n", p.PID, p.Command)
+		}
+	}
+	return w.Flush()
+}
+
 var deleteCmd = cli.Command{
 	Name:   "delete",
 	Usage:  "deletes a container",
@@ -605,6 +1117,52 @@ func doDelete(ctxcli *cli.Context) error {
 	return err
 }
 
+var gcCmd = cli.Command{
+	Name:   "gc",
+	Usage:  "removes orphaned container runtime state and cgroups",
+	Action: doGC,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only report what would be removed",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "maximum duration for gc to complete",
+			Value: time.Minute,
+		},
+	},
+}
+
+func doGC(ctxcli *cli.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ctxcli.Duration("timeout"))
+	defer cancel()
+
+	dryRun := ctxcli.Bool("dry-run")
+	report, err := clxc.GC(ctx, dryRun)
+	if report == nil {
+		return err
+	}
+
+	action := "removed"
+	if dryRun {
+		action = "would remove"
+	}
+	for _, id := range report.Containers {
+		fmt.Printf("%s container %s\n", action, id)
+	}
+	for _, dir := range report.RuntimeDirs {
+		fmt.Printf("%s runtime dir %s\n", action, dir)
+	}
+	for _, cg := range report.Cgroups {
+		fmt.Printf("%s cgroup %s\n", action, cg)
+	}
+	for _, f := range report.LockFiles {
+		fmt.Printf("%s lock file %s\n", action, f)
+	}
+	return err
+}
+
 var execCmd = cli.Command{
 	Name:      "exec",
 	Usage:     "execute a new process in a running container",
@@ -625,7 +1183,43 @@ var execCmd = cli.Command{
 		&cli.BoolFlag{
 			Name:    "detach",
 			Aliases: []string{"d"},
-			Usage:   "detach from the executed process",
+			Usage:   "detach from the executed process (the exit status is not recorded)",
+		},
+		&cli.StringFlag{
+			Name:  "exec-id",
+			Usage: "record an exec session with the given `ID` (generated for detached processes if unset)",
+		},
+		&cli.BoolFlag{
+			Name:    "tty",
+			Aliases: []string{"t"},
+			Usage:   "allocate a pseudo-TTY",
+		},
+		&cli.StringFlag{
+			Name:  "console-socket",
+			Usage: "send the pty master fd to this socket path",
+		},
+		&cli.StringSliceFlag{
+			Name:    "env",
+			Aliases: []string{"e"},
+			Usage:   "set environment variable `KEY=VALUE` for the process",
+		},
+		&cli.StringFlag{
+			Name:  "cwd",
+			Usage: "working directory of the process",
+		},
+		&cli.StringFlag{
+			Name:    "user",
+			Aliases: []string{"u"},
+			Usage:   "run the process as `UID[:GID]`",
+		},
+		&cli.StringSliceFlag{
+			Name:    "additional-gids",
+			Aliases: []string{"g"},
+			Usage:   "additional group IDs of the process",
+		},
+		&cli.IntFlag{
+			Name:  "preserve-fds",
+			Usage: "number of additional file descriptors (starting at fd 3) passed to the process",
 		},
 		&cli.BoolFlag{
 			Name:  "cgroup",
@@ -647,13 +1241,12 @@ var execCmd = cli.Command{
 			Name:  "pid",
 			Usage: "run in container PID namespace",
 		},
-		//&cli.BoolFlag{
-		//	Name:  "time",
-		//	Usage: "run in container time namespace",
-		//	Value: true,
-		//},
 		&cli.BoolFlag{
-			Name:  "user",
+			Name:  "time",
+			Usage: "run in container time namespace",
+		},
+		&cli.BoolFlag{
+			Name:  "userns",
 			Usage: "run in container user namespace",
 		},
 		&cli.BoolFlag{
@@ -670,19 +1263,28 @@ func (e execError) exitStatus() int {
 }
 
 func (e execError) Error() string {
-	// liblxc remaps execvp exit codes to shell exit codes.
-	// FIXME This is undocumented behaviour lxc/src/lxc/attach.c:lxc_attach_run_command
-	// https://github.com/lxc/go-lxc/blob/d1943fb48dc73ef5cbc0ef43ed585420f7b2eb3a/container.go#L1370
-	// RunCommandStatus returns with exitCode 126 or 127 but without error, so it is not possible to determine
-	// whether this is the exit code from the command itself (e.g a shell itself) or from liblxc exec.
-	switch int(e) {
-	case 126:
-		return "can not execute file: file header not recognized"
-	case 127:
-		return "executable file not found in $PATH"
-	default:
-		return fmt.Sprintf("cmd execution failed with exit status %d", e.exitStatus())
+	return fmt.Sprintf("cmd execution failed with exit status %d", e.exitStatus())
+}
+
+// execStartError is returned if the exec process could not be executed.
+// The exit status matches the exit status of a shell.
+type execStartError struct {
+	error
+}
+
+func (e execStartError) exitStatus() int {
+	if errors.Is(e.error, lxcri.ErrExecNotFound) {
+		return 127
 	}
+	return 126
+}
+
+func (e execStartError) Unwrap() error {
+	return e.error
+}
+
+func isExecStartError(err error) bool {
+	return errors.Is(err, lxcri.ErrExecNotFound) || errors.Is(err, lxcri.ErrExecPermission)
 }
 
 // loadSpecProcess calls ReadSpecProcessJSON if the given specProcessPath is not empty,
@@ -698,6 +1300,33 @@ func loadSpecProcess(specProcessPath string, args []string) (*specs.Process, err
 	return &specs.Process{Cwd: "/", Args: args}, nil
 }
 
+// setExecProcessFlags merges the exec command line flags
+// into the given process spec.
+func setExecProcessFlags(ctxcli *cli.Context, procSpec *specs.Process) error {
+	for _, kv := range ctxcli.StringSlice("env") {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("invalid environment variable %q", kv)
+		}
+		procSpec.Env, _ = specki.Setenv(procSpec.Env, kv, true)
+	}
+	if cwd := ctxcli.String("cwd"); cwd != "" {
+		procSpec.Cwd = cwd
+	}
+	if user := ctxcli.String("user"); user != "" {
+		if err := parseUser(user, &procSpec.User); err != nil {
+			return err
+		}
+	}
+	for _, val := range ctxcli.StringSlice("additional-gids") {
+		gid, err := parseID(val)
+		if err != nil {
+			return fmt.Errorf("invalid additional gid: %w", err)
+		}
+		procSpec.User.AdditionalGids = append(procSpec.User.AdditionalGids, gid)
+	}
+	return nil
+}
+
 func doExec(ctxcli *cli.Context) error {
 	var args []string
 	if ctxcli.Args().Len() > 1 {
@@ -715,14 +1344,30 @@ func doExec(ctxcli *cli.Context) error {
 	if err != nil {
 		return err
 	}
-
-	c, err := clxc.loadContainer(clxc.containerID)
-	if err != nil {
+	if ctxcli.Bool("tty") {
+		procSpec.Terminal = true
+	}
+	if err := setExecProcessFlags(ctxcli, procSpec); err != nil {
 		return err
 	}
-	defer clxc.releaseContainer(c)
+	if procSpec.Terminal && ctxcli.String("console-socket") == "" {
+		return fmt.Errorf("console-socket is required if a tty is allocated")
+	}
 
-	opts := lxcri.ExecOptions{}
+	opts := lxcri.ExecOptions{
+		ConsoleSocket: ctxcli.String("console-socket"),
+		PreserveFds:   ctxcli.Int("preserve-fds"),
+		SessionID:     ctxcli.String("exec-id"),
+	}
+	if detach && opts.SessionID == "" {
+		opts.SessionID, err = newExecID()
+		if err != nil {
+			return err
+		}
+	}
+	if opts.PreserveFds < 0 {
+		return fmt.Errorf("invalid preserve-fds value %d", opts.PreserveFds)
+	}
 
 	if ctxcli.Bool("cgroup") {
 		opts.Namespaces = append(opts.Namespaces, specs.CgroupNamespace)
@@ -739,41 +1384,124 @@ func doExec(ctxcli *cli.Context) error {
 	if ctxcli.Bool("pid") {
 		opts.Namespaces = append(opts.Namespaces, specs.PIDNamespace)
 	}
-	//if ctxcli.Bool("time") {
-	//	opts.Namespaces = append(opts.Namespaces, specs.TimeNamespace)
-	//}
-	if ctxcli.Bool("user") {
+	if ctxcli.Bool("time") {
+		opts.Namespaces = append(opts.Namespaces, lxcri.TimeNamespace)
+	}
+	if ctxcli.Bool("userns") {
 		opts.Namespaces = append(opts.Namespaces, specs.UserNamespace)
 	}
 	if ctxcli.Bool("uts") {
 		opts.Namespaces = append(opts.Namespaces, specs.UTSNamespace)
 	}
 
-	c.Log.Info().Str("cmd", procSpec.Args[0]).
+	lock, err := clxc.lockContainer(lxcri.LockShared)
+	if err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		clxc.unlockContainer(lock)
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	c.Log.Info().Str("cmd", procSpec.Args[0]).Str("exec-id", opts.SessionID).
 		Uint32("uid", procSpec.User.UID).Uint32("gid", procSpec.User.GID).
 		Uints32("groups", procSpec.User.AdditionalGids).
 		Str("namespaces", fmt.Sprintf("%s", opts.Namespaces)).Msg("execute cmd")
 
+	p, err := c.StartExec(procSpec, &opts)
+	// The lock is only held until the process is started,
+	// because it would block delete until the process has exited.
+	clxc.unlockContainer(lock)
+	if isExecStartError(err) {
+		return execStartError{err}
+	}
+	if err != nil {
+		return err
+	}
+
 	if detach {
-		pid, err := c.ExecDetached(procSpec, &opts)
-		if err != nil {
-			return err
-		}
+		p.Release()
 		if pidFile != "" {
-			return createPidFile(pidFile, pid)
-		}
-	} else {
-		status, err := c.Exec(procSpec, &opts)
-		if err != nil {
-			return err
-		}
-		if status != 0 {
-			return execError(status)
+			return createPidFile(pidFile, p.Pid)
 		}
+		return nil
+	}
+	status, err := p.Wait(context.Background())
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return execError(status)
 	}
 	return nil
 }
 
+var execListCmd = cli.Command{
+	Name:   "exec-list",
+	Usage:  "lists the exec sessions of a container",
+	Action: doExecList,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format (table|json)",
+			Value: "table",
+		},
+	},
+}
+
+func doExecList(ctxcli *cli.Context) error {
+	format := ctxcli.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %q", format)
+	}
+
+	lock, err := clxc.lockContainer(lxcri.LockShared)
+	if err != nil {
+		return err
+	}
+	defer clxc.unlockContainer(lock)
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	sessions, err := c.ExecSessions()
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(sessions)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPID\tSTATUS\tCREATED\tCMD")
+	for _, s := range sessions {
+		// The exit status of a process that was not awaited
+		// (e.g started with 'exec --detach') is not recorded.
+		status := "unknown"
+		switch {
+		case s.ExitStatus != nil:
+			status = fmt.Sprintf("exited (%d)", *s.ExitStatus)
+		case s.Pid == 0:
+			status = "created"
+		case s.Running():
+			status = "running"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", s.ID, s.Pid, status,
+			s.CreatedAt.Format(time.RFC3339), strings.Join(s.Args, " "))
+	}
+	return w.Flush()
+}
+
 var inspectCmd = cli.Command{
 	Name:   "inspect",
 	Usage:  "display the status of one or more containers",
@@ -1,32 +1,19 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"golang.org/x/sys/unix"
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
-func parseSignal(sig string) unix.Signal {
-	if sig == "" {
-		return unix.SIGTERM
-	}
-	// handle numerical signal value
-	if num, err := strconv.Atoi(sig); err == nil {
-		return unix.Signal(num)
-	}
-
-	// gracefully handle all string variants e.g 'sigkill|SIGKILL|kill|KILL'
-	s := strings.ToUpper(sig)
-	if !strings.HasPrefix(s, "SIG") {
-		s = "SIG" + s
-	}
-	return unix.SignalNum(s)
-}
-
 // createPidFile atomically creates a pid file for the given pid at the given path
 func createPidFile(path string, pid int) error {
 	tmpDir := filepath.Dir(path)
@@ -51,3 +38,58 @@ func createPidFile(path string, pid int) error {
 	}
 	return nil
 }
+
+// parseUser parses a numeric user specification "uid[:gid]"
+// and sets the IDs in the given user.
+// The GID of the user is unchanged if gid is not set.
+func parseUser(val string, user *specs.User) error {
+	ids := strings.SplitN(val, ":", 2)
+	uid, err := parseID(ids[0])
+	if err != nil {
+		return fmt.Errorf("invalid user %q: %w", val, err)
+	}
+	user.UID = uid
+	if len(ids) == 2 {
+		gid, err := parseID(ids[1])
+		if err != nil {
+			return fmt.Errorf("invalid user %q: %w", val, err)
+		}
+		user.GID = gid
+	}
+	return nil
+}
+
+// parseID parses a numeric user or group ID.
+func parseID(id string) (uint32, error) {
+	v, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", id)
+	}
+	return uint32(v), nil
+}
+
+// newExecID returns a random exec session ID.
+func newExecID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate exec ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// loadTimeOffsets reads linux.timeOffsets from the given spec file.
+// The field is not defined by the runtime-spec version used by lxcri.
+func loadTimeOffsets(specPath string) (map[string]lxcri.TimeOffset, error) {
+	var spec struct {
+		Linux *struct {
+			TimeOffsets map[string]lxcri.TimeOffset `json:"timeOffsets,omitempty"`
+		} `json:"linux,omitempty"`
+	}
+	if err := specki.DecodeJSONFile(specPath, &spec); err != nil {
+		return nil, err
+	}
+	if spec.Linux == nil {
+		return nil, nil
+	}
+	return spec.Linux.TimeOffsets, nil
+}
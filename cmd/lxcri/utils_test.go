@@ -1,32 +1,42 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
-	"golang.org/x/sys/unix"
-
+	"github.com/lxc/lxcri"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/require"
 )
 
-func TestParseSignal(t *testing.T) {
-	sig := parseSignal("9")
-	require.Equal(t, unix.SIGKILL, sig)
-
-	sig = parseSignal("kill")
-	require.Equal(t, unix.SIGKILL, sig)
-
-	sig = parseSignal("sigkill")
-	require.Equal(t, unix.SIGKILL, sig)
+func TestParseUser(t *testing.T) {
+	user := specs.User{UID: 1, GID: 2}
+	require.NoError(t, parseUser("1000", &user))
+	require.Equal(t, specs.User{UID: 1000, GID: 2}, user)
 
-	sig = parseSignal("KILL")
-	require.Equal(t, unix.SIGKILL, sig)
+	require.NoError(t, parseUser("0:100", &user))
+	require.Equal(t, specs.User{UID: 0, GID: 100}, user)
 
-	sig = parseSignal("SIGKILL")
-	require.Equal(t, unix.SIGKILL, sig)
-
-	sig = parseSignal("SIGNOTEXIST")
-	require.Equal(t, unix.Signal(0), sig)
+	for _, val := range []string{"", "root", "1000:", ":1000", "-1", "1:2:3", "4294967296"} {
+		require.Error(t, parseUser(val, &user), "user:%q", val)
+	}
+}
 
-	sig = parseSignal("66")
-	require.Equal(t, unix.Signal(66), sig)
+func TestLoadTimeOffsets(t *testing.T) {
+	specPath := filepath.Join(t.TempDir(), "config.json")
+	config := `{"linux":{"namespaces":[{"type":"time"}],"timeOffsets":{"monotonic":{"secs":-10},"boottime":{"secs":3600,"nanosecs":500}}}}`
+	require.NoError(t, os.WriteFile(specPath, []byte(config), 0640))
+
+	offsets, err := loadTimeOffsets(specPath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]lxcri.TimeOffset{
+		"monotonic": {Secs: -10},
+		"boottime":  {Secs: 3600, Nanosecs: 500},
+	}, offsets)
+
+	require.NoError(t, os.WriteFile(specPath, []byte(`{"ociVersion":"1.0.2"}`), 0640))
+	offsets, err = loadTimeOffsets(specPath)
+	require.NoError(t, err)
+	require.Nil(t, offsets)
 }
@@ -2,12 +2,16 @@ package lxcri
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/creack/pty"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/rs/zerolog"
@@ -15,6 +19,11 @@ import (
 	"gopkg.in/lxc/go-lxc.v2"
 )
 
+// StatePaused indicates that all processes of the container are frozen.
+// The state is not defined by the OCI runtime spec, but the value is
+// the same as the one used by runc and expected by CRI-O.
+const StatePaused specs.ContainerState = "paused"
+
 // ContainerConfig is the configuration for a single Container instance.
 type ContainerConfig struct {
 	// The Spec used to generate the liblxc config file.
@@ -25,6 +34,11 @@ type ContainerConfig struct {
 	// and spec.Namespaces are required for attach.
 	Spec *specs.Spec
 
+	// TimeOffsets are the clock offsets of the container time namespace
+	// (see TimeNamespace). The keys are the clock names "monotonic" and "boottime".
+	// TODO Replace with Spec.Linux.TimeOffsets when runtime-spec is updated to v1.1.
+	TimeOffsets map[string]TimeOffset `json:",omitempty"`
+
 	// ContainerID is the identifier of the container.
 	// The ContainerID is used as name for the containers runtime directory.
 	// The ContainerID must be unique at least through all containers of a runtime.
@@ -80,6 +94,11 @@ type Container struct {
 	CreatedAt time.Time
 	// Pid is the process ID of the liblxc monitor process ( see ExecStart )
 	Pid int
+	// PidStartTime is the start time of the liblxc monitor process
+	// in clock ticks after system boot (see processStartTime).
+	// Together with Pid it identifies the monitor process
+	// and protects against PID reuse.
+	PidStartTime uint64
 
 	runtimeDir string
 }
@@ -131,18 +150,50 @@ func (c *Container) load() error {
 	return nil
 }
 
+// save atomically replaces the runtime config (lxcri.json)
+// of the container with the current container state.
+func (c *Container) save() error {
+	tmp, err := os.CreateTemp(c.RuntimePath(), ".lxcri.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(c); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode JSON to %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0440); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.RuntimePath("lxcri.json"))
+}
+
 func (c *Container) waitMonitorStopped(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if !c.isMonitorRunning() {
-				return nil
-			}
-			time.Sleep(time.Millisecond * 100)
-		}
+	if !c.isMonitorRunning() {
+		return nil
 	}
+	if err := waitProcessExit(ctx, c.Pid, c.PidStartTime, c.isMonitorRunning); err != nil {
+		return err
+	}
+	// reap the monitor process if it is a child of this process
+	c.isMonitorRunning()
+	return nil
+}
+
+// waitCgroupEmpty waits until the container cgroup does not contain any process.
+func (c *Container) waitCgroupEmpty(ctx context.Context) error {
+	eventsFile := filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.events")
+	err := pollCgroupEvents(ctx, eventsFile, func(ev cgroupEvents) bool {
+		return !ev.populated
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
 }
 
 func (c *Container) isMonitorRunning() bool {
@@ -167,13 +218,18 @@ func (c *Container) isMonitorRunning() bool {
 	// This runtime process may not be the parent of the monitor process
 	if err == unix.ECHILD {
 		// check if the process is still runnning
-		err := unix.Kill(c.Pid, 0)
+		var err error
+		if c.PidStartTime == 0 {
+			err = unix.Kill(c.Pid, 0)
+		} else {
+			// The PID may have been reused after the monitor has exited.
+			err = checkProcessStartTime(c.Pid, c.PidStartTime)
+		}
 		if err == nil {
 			return true
 		}
-		// it's not running
-		if err == unix.ESRCH {
-			return false
+		if errors.Is(err, ErrStalePid) {
+			c.Log.Warn().Msgf("monitor process has exited: %s", err)
 		}
 	}
 	return false
@@ -191,7 +247,14 @@ func (c *Container) waitCreated(ctx context.Context) error {
 			state := c.LinuxContainer.State()
 			if !(state == lxc.RUNNING) {
 				c.Log.Debug().Stringer("state", state).Msg("wait for state lxc.RUNNING")
-				time.Sleep(time.Millisecond * 100)
+				if waitPolling {
+					time.Sleep(time.Millisecond * 100)
+				} else {
+					// Wait returns immediately when the state changes.
+					// The timeout (minimum 1s) limits the delay for detecting
+					// a dead monitor process or a cancelled context.
+					c.LinuxContainer.Wait(lxc.RUNNING, time.Second)
+				}
 				continue
 			}
 			initState, err := c.getContainerInitState()
@@ -206,7 +269,20 @@ func (c *Container) waitCreated(ctx context.Context) error {
 	}
 }
 
-func (c *Container) waitStarted(ctx context.Context) error {
+// waitStarted waits until the container init process has executed
+// the container process. The write end of the sync fifo is kept open
+// by the caller. lxcri-init keeps the read end open until it calls exec,
+// which closes the read end because of O_CLOEXEC.
+// Poll signals POLLERR on the write end when the last reader closed the fifo.
+func (c *Container) waitStarted(ctx context.Context, fifo *os.File) error {
+	if !waitPolling {
+		err := pollFd(ctx, int(fifo.Fd()), 0)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		c.Log.Warn().Msgf("failed to poll sync fifo: %s", err)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -229,6 +305,9 @@ type State struct {
 	ContainerState string
 	RuntimePath    string
 	SpecState      specs.State
+	// ExitStatus is the exit status of the container process.
+	// It is only set if the container is stopped.
+	ExitStatus *ExitStatus `json:",omitempty"`
 }
 
 // State returns the runtime state of the containers process.
@@ -253,6 +332,13 @@ func (c *Container) State() (*State, error) {
 		},
 	}
 
+	if status == specs.StateStopped {
+		state.ExitStatus, err = c.ExitStatus()
+		if err != nil {
+			c.Log.Warn().Msgf("failed to get exit status: %s", err)
+		}
+	}
+
 	return state, nil
 }
 
@@ -269,12 +355,38 @@ func (c *Container) state(s lxc.State) (specs.ContainerState, error) {
 	case lxc.STARTING:
 		return specs.StateCreating, nil
 	case lxc.RUNNING, lxc.STOPPING, lxc.ABORTING, lxc.FREEZING, lxc.FROZEN, lxc.THAWED:
-		return c.getContainerInitState()
+		initState, err := c.getContainerInitState()
+		if err != nil || initState == specs.StateStopped {
+			return initState, err
+		}
+		frozen, err := c.isFrozen()
+		if err != nil {
+			return initState, err
+		}
+		if frozen {
+			return StatePaused, nil
+		}
+		return initState, nil
 	default:
 		return specs.StateStopped, fmt.Errorf("unsupported lxc container state %q", s)
 	}
 }
 
+// isFrozen returns true if the cgroup of the container is frozen.
+func (c *Container) isFrozen() (bool, error) {
+	if c.CgroupDir == "" {
+		return false, nil
+	}
+	ev, err := parseCgroupEvents(filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.events"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to parse cgroup events: %w", err)
+	}
+	return ev.frozen, nil
+}
+
 // getContainerInitState returns the detailed state of the container init process.
 // This should be called if the container is in state lxc.RUNNING.
 // On error the caller should call getContainerState() again
@@ -316,6 +428,22 @@ func (c *Container) kill(ctx context.Context, signum unix.Signal) error {
 	return nil
 }
 
+// killInit sends the signal signum to the container init process.
+func (c *Container) killInit(signum unix.Signal) error {
+	pid := c.LinuxContainer.InitPid()
+	if pid < 1 {
+		return errorf("container init process is not running")
+	}
+	c.Log.Info().Int("signum", int(signum)).Int("pid", pid).Msg("killing container init process")
+	// The init PID is verified by the cgroup membership,
+	// since it might have been reused after the init process has exited.
+	err := signalCgroupProcess(pid, c.CgroupDir, signum)
+	if err == unix.ESRCH {
+		return errorf("container init process %d has exited", pid)
+	}
+	return err
+}
+
 // getConfigItem is a wrapper function and returns the
 // first value returned by lxc.Container.ConfigItem
 func (c *Container) getConfigItem(key string) string {
@@ -369,10 +497,31 @@ func (c *Container) start(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	err = c.waitStarted(ctx, fifo)
+	if err == nil {
+		err = c.checkInitError()
+	}
 	if err := fifo.Close(); err != nil {
-		return err
+		c.Log.Warn().Msgf("failed to close sync fifo: %s", err)
 	}
-	return c.waitStarted(ctx)
+	return err
+}
+
+// checkInitError returns an error if lxcri-init reported an error over the sync fifo.
+// The message is written to the runtime directory and becomes the ExitStatus.Message.
+// It must be called while the write end of the sync fifo is still open.
+func (c *Container) checkInitError() error {
+	msg, err := readInitError(c.syncFifoPath())
+	if err != nil {
+		return errorf("failed to read init error: %w", err)
+	}
+	if msg == "" {
+		return nil
+	}
+	if err := os.WriteFile(c.RuntimePath(initErrorFile), []byte(msg), 0440); err != nil {
+		c.Log.Warn().Msgf("failed to write init error: %s", err)
+	}
+	return errorf("container init failed: %q", msg)
 }
 
 // ExecOptions contains options for Container.Exec and Container.ExecDetached
@@ -380,40 +529,77 @@ type ExecOptions struct {
 	// Namespaces is the list of container namespaces that the process is attached to.
 	// The process will is attached to all container namespaces if Namespaces is empty.
 	Namespaces []specs.LinuxNamespaceType
+
+	// ConsoleSocket is the path to the unix socket the pty master is sent to.
+	// It is required if specs.Process.Terminal is true.
+	ConsoleSocket string
+
+	// PreserveFds is the number of additional file descriptors,
+	// starting at file descriptor 3, that are passed to the process.
+	// All other file descriptors (except stdio) are closed on exec.
+	// This changes the close-on-exec flag of all file descriptors
+	// of the calling process while the process is started.
+	// The original flags are restored afterwards, but processes forked
+	// concurrently by the caller may inherit the preserved file descriptors.
+	PreserveFds int
+
+	// Stdin, Stdout and Stderr specify the stdio of the process.
+	// If the value is an *os.File the file descriptor is passed to the process.
+	// Otherwise a pipe is created and the data is copied from / to the value.
+	// The stdio of the calling process is used if a value is nil.
+	// The stdio values must be nil if specs.Process.Terminal is true.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// SessionID is the ID of the exec session that is recorded for the process
+	// (see ExecSession). No session is recorded if SessionID is empty.
+	// The exit status is only recorded if the process is awaited with
+	// ExecProcess.Wait, it is never recorded for ExecDetached.
+	SessionID string
+}
+
+// checkExecState returns an error if the container state does not permit
+// to execute a process within the container.
+// A process attached to a paused container would block until the
+// container is resumed.
+func (c *Container) checkExecState() error {
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != specs.StateCreated && state != specs.StateRunning {
+		return errorf("can not exec in container with state %q", state)
+	}
+	return nil
 }
 
 // ExecDetached executes the given process spec within the container.
 // The given process is started and the process PID is returned.
 // It's up to the caller to wait for the process to exit using the returned PID.
+// The exit status of the process is not recorded in the exec session (see ExecSession.ExitStatus).
 // The container state must be either specs.StateCreated or specs.StateRunning
 // The given ExecOptions execOpts, control the execution environment of the the process.
 func (c *Container) ExecDetached(proc *specs.Process, execOpts *ExecOptions) (pid int, err error) {
-	opts, err := c.attachOptions(proc, execOpts)
+	p, err := c.StartExec(proc, execOpts)
 	if err != nil {
-		return 0, errorf("failed to create attach options: %w", err)
+		return 0, err
 	}
-
-	pid, err = c.LinuxContainer.RunCommandNoWait(proc.Args, opts)
-	if err != nil {
-		return pid, errorf("failed to run exec cmd detached: %w", err)
-	}
-	return pid, nil
+	p.Release()
+	return p.Pid, nil
 }
 
 // Exec executes the given process spec within the container.
 // It waits for the process to exit and returns its exit code.
+// Starting the process might block for a bounded time (see StartExec).
 // The container state must either be specs.StateCreated or specs.StateRunning
 // The given ExecOptions execOpts control the execution environment of the the process.
 func (c *Container) Exec(proc *specs.Process, execOpts *ExecOptions) (exitStatus int, err error) {
-	opts, err := c.attachOptions(proc, execOpts)
+	p, err := c.StartExec(proc, execOpts)
 	if err != nil {
-		return 0, errorf("failed to create attach options: %w", err)
+		return 0, err
 	}
-	exitStatus, err = c.LinuxContainer.RunCommandStatus(proc.Args, opts)
-	if err != nil {
-		return exitStatus, errorf("failed to run exec cmd: %w", err)
-	}
-	return exitStatus, nil
+	return p.Wait(context.Background())
 }
 
 func (c *Container) attachOptions(procSpec *specs.Process, execOpts *ExecOptions) (lxc.AttachOptions, error) {
@@ -426,6 +612,9 @@ func (c *Container) attachOptions(procSpec *specs.Process, execOpts *ExecOptions
 	if procSpec == nil {
 		return opts, fmt.Errorf("process spec is nil")
 	}
+	if err := c.checkExecSecurity(procSpec); err != nil {
+		return opts, err
+	}
 	opts.Cwd = procSpec.Cwd
 	// Use the environment defined by the process spec.
 	opts.ClearEnv = true
@@ -464,6 +653,47 @@ func (c *Container) attachOptions(procSpec *specs.Process, execOpts *ExecOptions
 	return opts, nil
 }
 
+// attachTerminal allocates a new pty and sends the pty master to the
+// console socket from execOpts. The pty slave is set as stdio in opts
+// and must be closed by the caller after the process was attached.
+func attachTerminal(opts *lxc.AttachOptions, procSpec *specs.Process, execOpts *ExecOptions) (*os.File, error) {
+	if execOpts == nil || execOpts.ConsoleSocket == "" {
+		return nil, fmt.Errorf("console socket is required for a terminal")
+	}
+
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate pty: %w", err)
+	}
+	// The pty master is owned by the console socket receiver.
+	defer ptmx.Close()
+
+	if size := procSpec.ConsoleSize; size != nil {
+		ws := pty.Winsize{Rows: uint16(size.Height), Cols: uint16(size.Width)}
+		if err := pty.Setsize(ptmx, &ws); err != nil {
+			tty.Close()
+			return nil, fmt.Errorf("failed to set console size: %w", err)
+		}
+	}
+
+	conn, err := dialConsoleSocket(context.Background(), execOpts.ConsoleSocket)
+	if err != nil {
+		tty.Close()
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := sendConsole(conn, ptmx); err != nil {
+		tty.Close()
+		return nil, err
+	}
+
+	opts.StdinFd = tty.Fd()
+	opts.StdoutFd = tty.Fd()
+	opts.StderrFd = tty.Fd()
+	return tty, nil
+}
+
 // SetLog changes log file path and log level of the container (liblxc) instance.
 // The settings are only valid until Release is called on this instance.
 // The log settings applied at Runtime.Create are active until SetLog is called.
@@ -0,0 +1,118 @@
+package lxcri
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/creack/pty"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// receiveConsole accepts a single connection on the console socket
+// and returns the received pty master.
+func receiveConsole(t *testing.T, l *net.UnixListener) <-chan *os.File {
+	ch := make(chan *os.File, 1)
+	go func() {
+		defer close(ch)
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			t.Errorf("accept failed: %s", err)
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 32)
+		oob := make([]byte, unix.CmsgSpace(4))
+		_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			t.Errorf("failed to receive console: %s", err)
+			return
+		}
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			t.Errorf("invalid control message: %v", err)
+			return
+		}
+		fds, err := unix.ParseUnixRights(&msgs[0])
+		if err != nil || len(fds) != 1 {
+			t.Errorf("invalid unix rights: %v", err)
+			return
+		}
+		ch <- os.NewFile(uintptr(fds[0]), "ptmx")
+	}()
+	return ch
+}
+
+func TestAttachTerminal(t *testing.T) {
+	consoleSocket := filepath.Join(t.TempDir(), "console.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: consoleSocket, Net: "unix"})
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := receiveConsole(t, l)
+
+	proc := &specs.Process{Terminal: true, ConsoleSize: &specs.Box{Height: 24, Width: 80}}
+	var opts lxc.AttachOptions
+	tty, err := attachTerminal(&opts, proc, &ExecOptions{ConsoleSocket: consoleSocket})
+	require.NoError(t, err)
+	defer tty.Close()
+
+	require.Equal(t, tty.Fd(), opts.StdinFd)
+	require.Equal(t, tty.Fd(), opts.StdoutFd)
+	require.Equal(t, tty.Fd(), opts.StderrFd)
+
+	ptmx := <-received
+	require.NotNil(t, ptmx)
+	defer ptmx.Close()
+
+	rows, cols, err := pty.Getsize(tty)
+	require.NoError(t, err)
+	require.Equal(t, 24, rows)
+	require.Equal(t, 80, cols)
+
+	// output written to the pty slave is readable from the received master
+	_, err = tty.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	buf := make([]byte, 32)
+	n, err := ptmx.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello\r\n", string(buf[:n]))
+}
+
+func TestAttachTerminalNoConsoleSocket(t *testing.T) {
+	var opts lxc.AttachOptions
+	_, err := attachTerminal(&opts, &specs.Process{Terminal: true}, nil)
+	require.Error(t, err)
+}
+
+func TestContainerSave(t *testing.T) {
+	dir := t.TempDir()
+	c := &Container{
+		ContainerConfig: &ContainerConfig{ContainerID: "c1", Spec: &specs.Spec{}},
+		runtimeDir:      dir,
+	}
+	// a temporary file left behind by a previous save
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".lxcri.json"), nil, 0440))
+
+	require.NoError(t, c.save())
+	c.ContainerID = "c2"
+	require.NoError(t, c.save())
+
+	loaded := new(Container)
+	require.NoError(t, specki.DecodeJSONFile(filepath.Join(dir, "lxcri.json"), loaded))
+	require.Equal(t, "c2", loaded.ContainerID)
+
+	info, err := os.Stat(filepath.Join(dir, "lxcri.json"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0440), info.Mode().Perm())
+
+	names, err := readDirNames(dir)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{".lxcri.json", "lxcri.json"}, names)
+}
@@ -16,11 +16,18 @@ import (
 // A created Container must be released with Container.Release after use.
 // You should call Runtime.Delete to cleanup container runtime state, even
 // if the Create returned with an error.
+// The container is locked in LockExclusive mode until Create returns.
 func (rt *Runtime) Create(ctx context.Context, cfg *ContainerConfig) (*Container, error) {
 	if err := rt.checkConfig(cfg); err != nil {
 		return nil, err
 	}
 
+	lock, err := rt.Lock(ctx, cfg.ContainerID, LockExclusive)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
 	c := &Container{ContainerConfig: cfg}
 	c.runtimeDir = filepath.Join(rt.Root, c.ContainerID)
 
@@ -42,7 +49,7 @@ func (rt *Runtime) Create(ctx context.Context, cfg *ContainerConfig) (*Container
 	// Seralize the modified spec.Spec separately, to make it available for
 	// runtime hooks.
 	specPath := c.RuntimePath(BundleConfigFile)
-	err := specki.EncodeJSONFile(specPath, cfg.Spec, os.O_EXCL|os.O_CREATE, 0444)
+	err = specki.EncodeJSONFile(specPath, cfg.Spec, os.O_EXCL|os.O_CREATE, 0444)
 	if err != nil {
 		return c, err
 	}
@@ -181,14 +188,15 @@ func configureContainer(rt *Runtime, c *Container) error {
 		c.Spec.Linux.Devices = nil
 	}
 
-	if err := configureHooks(rt, c); err != nil {
-		return err
-	}
-
 	if err := configureCgroup(rt, c); err != nil {
 		return fmt.Errorf("failed to configure cgroups: %w", err)
 	}
 
+	// The stop hook requires the container cgroup path.
+	if err := configureHooks(rt, c); err != nil {
+		return err
+	}
+
 	for key, val := range c.Spec.Linux.Sysctl {
 		if err := c.setConfigItem("lxc.sysctl."+key, val); err != nil {
 			return err
@@ -378,6 +386,18 @@ func configureHooks(rt *Runtime, c *Container) error {
 			return err
 		}
 	}
+
+	// The liblxc stop hook runs before the container cgroup is destroyed.
+	// lxcri-hook copies memory.events to the runtime directory,
+	// to detect OOM kills after the container has stopped (see Container.ExitStatus).
+	// liblxc executes the hook command line with /bin/sh.
+	memoryEvents := filepath.Join(cgroupRoot, c.CgroupDir, "memory.events")
+	if strings.ContainsAny(memoryEvents, "\n\x00") {
+		return fmt.Errorf("invalid cgroup path %q", c.CgroupDir)
+	}
+	if err := c.setConfigItem("lxc.hook.stop", rt.libexec(ExecHook)+" -memory-events "+shellQuote(memoryEvents)); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -0,0 +1,122 @@
+package lxcri
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Event types emitted by Container.Events
+const (
+	EventTypeStats = "stats"
+	EventTypeOOM   = "oom"
+	EventTypeState = "state"
+)
+
+// Event is a container event.
+// The JSON encoding is compatible with runc `events`.
+type Event struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// CgroupState is the data of an EventTypeState event.
+// It is the state of the container cgroup from cgroup.events
+type CgroupState struct {
+	Populated bool `json:"populated"`
+	Frozen    bool `json:"frozen"`
+}
+
+// eventsPollInterval is the interval the cgroup interface files
+// are checked for changes by Container.Events
+var eventsPollInterval = time.Millisecond * 100
+
+// Events calls fn for every container event until the container cgroup
+// is no longer populated, the context is cancelled or fn returns an error.
+// An EventTypeState event with the current cgroup state is emitted first,
+// followed by an event for every change of the cgroup state.
+// An EventTypeOOM event is emitted for every OOM kill within the container cgroup.
+// If interval is greater than zero an EventTypeStats event is emitted every interval.
+func (c *Container) Events(ctx context.Context, interval time.Duration, fn func(Event) error) error {
+	if c.CgroupDir == "" {
+		return errorf("container cgroup is undefined")
+	}
+	dir := filepath.Join(cgroupRoot, c.CgroupDir)
+
+	poll := time.NewTicker(eventsPollInterval)
+	defer poll.Stop()
+
+	var stats <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		stats = t.C
+	}
+
+	oomKills, err := readOOMKills(dir)
+	if err != nil {
+		return errorf("failed to read memory events: %w", err)
+	}
+
+	var state *CgroupState
+	for {
+		ev, err := parseCgroupEvents(filepath.Join(dir, "cgroup.events"))
+		if os.IsNotExist(err) {
+			// cgroup was deleted
+			return nil
+		}
+		if err != nil {
+			return errorf("failed to parse cgroup events: %w", err)
+		}
+
+		n, err := readOOMKills(dir)
+		if err != nil {
+			return errorf("failed to read memory events: %w", err)
+		}
+		for ; oomKills < n; oomKills++ {
+			if err := fn(Event{Type: EventTypeOOM, ID: c.ContainerID}); err != nil {
+				return err
+			}
+		}
+
+		current := CgroupState{Populated: ev.populated, Frozen: ev.frozen}
+		if state == nil || *state != current {
+			state = &current
+			if err := fn(Event{Type: EventTypeState, ID: c.ContainerID, Data: current}); err != nil {
+				return err
+			}
+		}
+		if !current.Populated {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stats:
+			s, err := readCgroupStats(dir)
+			if err != nil {
+				return errorf("failed to read cgroup stats: %w", err)
+			}
+			if err := fn(Event{Type: EventTypeStats, ID: c.ContainerID, Data: s}); err != nil {
+				return err
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+// readOOMKills returns the number of processes killed by the OOM killer
+// within the cgroup dir. It returns 0 if the memory controller is not enabled.
+func readOOMKills(dir string) (uint64, error) {
+	events, err := parseFlatKeyed(filepath.Join(dir, "memory.events"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return events["oom_kill"], nil
+}
@@ -0,0 +1,826 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// The liblxc attach options (exposed by go-lxc) do not control the
+// process security context. liblxc attaches the process with the
+// capabilities, apparmor profile, seccomp profile and no_new_privs
+// setting of the container. Resource limits, the OOM score and
+// no_new_privs for a single process are applied by the exec helper.
+
+var (
+	// ErrExecNotFound is returned if the executable of an exec process is not found.
+	ErrExecNotFound = fmt.Errorf("executable file not found")
+	// ErrExecPermission is returned if the executable of an exec process
+	// can not be executed because permission is denied.
+	ErrExecPermission = fmt.Errorf("permission denied to execute file")
+)
+
+// execHelper is the path to lxcri-init within the container (see configureInit).
+// lxcri-init executes the exec process and reports exec errors to the runtime.
+const execHelper = "/.lxcri/lxcri-init"
+
+var rlimitMap = map[string]int{
+	"RLIMIT_AS":         unix.RLIMIT_AS,
+	"RLIMIT_CORE":       unix.RLIMIT_CORE,
+	"RLIMIT_CPU":        unix.RLIMIT_CPU,
+	"RLIMIT_DATA":       unix.RLIMIT_DATA,
+	"RLIMIT_FSIZE":      unix.RLIMIT_FSIZE,
+	"RLIMIT_LOCKS":      unix.RLIMIT_LOCKS,
+	"RLIMIT_MEMLOCK":    unix.RLIMIT_MEMLOCK,
+	"RLIMIT_MSGQUEUE":   unix.RLIMIT_MSGQUEUE,
+	"RLIMIT_NICE":       unix.RLIMIT_NICE,
+	"RLIMIT_NOFILE":     unix.RLIMIT_NOFILE,
+	"RLIMIT_NPROC":      unix.RLIMIT_NPROC,
+	"RLIMIT_RSS":        unix.RLIMIT_RSS,
+	"RLIMIT_RTPRIO":     unix.RLIMIT_RTPRIO,
+	"RLIMIT_RTTIME":     unix.RLIMIT_RTTIME,
+	"RLIMIT_SIGPENDING": unix.RLIMIT_SIGPENDING,
+	"RLIMIT_STACK":      unix.RLIMIT_STACK,
+}
+
+// checkExecSecurity returns an error if the security context of the
+// exec process spec can not be applied by liblxc attach.
+func (c *Container) checkExecSecurity(proc *specs.Process) error {
+	if err := checkExecCapabilities(proc.Capabilities, c.Spec.Process.Capabilities); err != nil {
+		return err
+	}
+
+	if proc.ApparmorProfile != "" {
+		profile := c.getConfigItem("lxc.apparmor.profile")
+		if profile == "" {
+			return fmt.Errorf("apparmor profile %q requested but apparmor is disabled", proc.ApparmorProfile)
+		}
+		if proc.ApparmorProfile != profile {
+			return fmt.Errorf("apparmor profile %q differs from container profile %q", proc.ApparmorProfile, profile)
+		}
+	}
+
+	if proc.SelinuxLabel != "" && proc.SelinuxLabel != c.Spec.Process.SelinuxLabel {
+		return fmt.Errorf("selinux label %q differs from container label %q", proc.SelinuxLabel, c.Spec.Process.SelinuxLabel)
+	}
+
+	if !proc.NoNewPrivileges && c.Spec.Process.NoNewPrivileges {
+		return fmt.Errorf("no_new_privs is set for the container and can not be unset")
+	}
+
+	seenLimits := make([]string, 0, len(proc.Rlimits))
+	for _, limit := range proc.Rlimits {
+		name := strings.ToUpper(limit.Type)
+		if _, ok := rlimitMap[name]; !ok {
+			return fmt.Errorf("unsupported resource limit %q", limit.Type)
+		}
+		if contains(seenLimits, name) {
+			return fmt.Errorf("duplicate resource limit %q", limit.Type)
+		}
+		seenLimits = append(seenLimits, name)
+	}
+	return nil
+}
+
+// checkExecCapabilities ensures that the exec process gets
+// exactly the capabilities of the container process.
+// The container capabilities are dropped by liblxc (see lxc.cap.keep),
+// the capability sets can not be changed for a single attached process.
+func checkExecCapabilities(caps *specs.LinuxCapabilities, containerCaps *specs.LinuxCapabilities) error {
+	if caps == nil {
+		return nil
+	}
+	var allowed []string
+	if containerCaps != nil {
+		allowed = containerCaps.Permitted
+	}
+
+	sets := []struct {
+		name string
+		caps []string
+	}{
+		{"bounding", caps.Bounding},
+		{"effective", caps.Effective},
+		{"inheritable", caps.Inheritable},
+		{"permitted", caps.Permitted},
+		{"ambient", caps.Ambient},
+	}
+	for _, set := range sets {
+		for _, cp := range set.caps {
+			if !containsCapability(allowed, cp) {
+				return fmt.Errorf("%s capability %s is not granted to the container", set.name, cp)
+			}
+		}
+	}
+	for _, cp := range allowed {
+		if !containsCapability(caps.Permitted, cp) {
+			return fmt.Errorf("dropping the permitted capability %s for an exec process is not supported", cp)
+		}
+	}
+	return nil
+}
+
+func containsCapability(caps []string, cp string) bool {
+	name := strings.TrimPrefix(strings.ToUpper(cp), "CAP_")
+	for _, c := range caps {
+		if strings.TrimPrefix(strings.ToUpper(c), "CAP_") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// execContextMu serializes the start of attached processes,
+// so that the file descriptors of the exec helper are only
+// inherited by the process they are created for.
+var execContextMu sync.Mutex
+
+// needsExecContext returns true if process attributes from proc
+// must be applied by the exec helper.
+func (c *Container) needsExecContext(proc *specs.Process) bool {
+	return len(proc.Rlimits) > 0 || proc.OOMScoreAdj != nil ||
+		(proc.NoNewPrivileges && !c.Spec.Process.NoNewPrivileges)
+}
+
+// setExecContext applies the resource limits and the OOM score from proc
+// to the attached process with the given pid.
+// The exec helper waits until they are applied before the process is executed.
+// The attached process is a child of the calling process, so the pid can not be reused.
+func setExecContext(pid int, proc *specs.Process) error {
+	for _, limit := range proc.Rlimits {
+		rlim := &unix.Rlimit{Cur: limit.Soft, Max: limit.Hard}
+		if err := prlimit(pid, rlimitMap[strings.ToUpper(limit.Type)], rlim, nil); err != nil {
+			return fmt.Errorf("failed to set resource limit %s: %w", limit.Type, err)
+		}
+	}
+
+	if proc.OOMScoreAdj != nil {
+		// Decreasing the OOM score requires CAP_SYS_RESOURCE.
+		val := []byte(strconv.Itoa(*proc.OOMScoreAdj))
+		if err := os.WriteFile(fmt.Sprintf("/proc/%d/oom_score_adj", pid), val, 0); err != nil {
+			return fmt.Errorf("failed to set oom_score_adj: %w", err)
+		}
+	}
+	return nil
+}
+
+// prlimit gets and sets the resource limits of the process pid (see prlimit(2)).
+func prlimit(pid int, resource int, newLimit *unix.Rlimit, oldLimit *unix.Rlimit) error {
+	// #nosec
+	_, _, errno := unix.RawSyscall6(unix.SYS_PRLIMIT64, uintptr(pid), uintptr(resource),
+		uintptr(unsafe.Pointer(newLimit)), uintptr(unsafe.Pointer(oldLimit)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// inheritFds clears the close-on-exec flag of the n file descriptors
+// starting at file descriptor 3, so they are inherited by the attached process.
+// The close-on-exec flag is set for all other file descriptors >= 3+n.
+// The returned function restores the original flags.
+func inheritFds(n int) (restore func() error, err error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid number of file descriptors %d", n)
+	}
+	orig := make(map[int]int)
+	restore = func() error {
+		for fd, flags := range orig {
+			if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, flags); err != nil {
+				return fmt.Errorf("failed to restore flags of file descriptor %d: %w", fd, err)
+			}
+		}
+		return nil
+	}
+	setCloexec := func(fd int, cloexec bool) error {
+		flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+		if err != nil {
+			return err
+		}
+		newFlags := flags &^ unix.FD_CLOEXEC
+		if cloexec {
+			newFlags = flags | unix.FD_CLOEXEC
+		}
+		if newFlags == flags {
+			return nil
+		}
+		if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, newFlags); err != nil {
+			return err
+		}
+		orig[fd] = flags
+		return nil
+	}
+
+	for fd := 3; fd < 3+n; fd++ {
+		if err := setCloexec(fd, false); err != nil {
+			// #nosec
+			restore()
+			return nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+		}
+	}
+
+	// Reading the directory opens a file descriptor that is closed afterwards.
+	names, err := readDirNames("/proc/self/fd")
+	if err != nil {
+		// #nosec
+		restore()
+		return nil, err
+	}
+	for _, name := range names {
+		fd, err := strconv.Atoi(name)
+		if err != nil || fd < 3+n {
+			continue
+		}
+		// EBADF is expected for the closed directory file descriptor.
+		if err := setCloexec(fd, true); err != nil && err != unix.EBADF {
+			// #nosec
+			restore()
+			return nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+		}
+	}
+	return restore, nil
+}
+
+// ExecProcess is a process executed within the container (see Container.StartExec).
+type ExecProcess struct {
+	// Pid is the process ID of the process (in the runtime PID namespace).
+	Pid int
+
+	// pidfd refers to the process, it is -1 if pidfd_open is not supported.
+	pidfd int
+
+	// closeAfterWait are the parent ends of the stdio pipes.
+	closeAfterWait []io.Closer
+	// copying is done when all output was copied from the stdio pipes.
+	copying sync.WaitGroup
+
+	mu sync.Mutex
+	// exited is true if the process was reaped (or released).
+	exited bool
+	waited bool
+
+	// session is the recorded exec session, it is nil if no session is recorded.
+	session *ExecSession
+	c       *Container
+}
+
+// StartExec executes the given process spec within the container
+// and returns a handle to the started process.
+// The caller must either call ExecProcess.Wait or ExecProcess.Release.
+// If the process is executed through the exec helper, StartExec blocks until the
+// helper has executed the process, for at most 10 seconds.
+// If the helper does not execute the process in time, the process is killed and an error is returned.
+// The container state must be either specs.StateCreated or specs.StateRunning
+// The given ExecOptions execOpts control the execution environment of the the process.
+func (c *Container) StartExec(proc *specs.Process, execOpts *ExecOptions) (*ExecProcess, error) {
+	if err := c.checkExecState(); err != nil {
+		return nil, err
+	}
+	opts, err := c.attachOptions(proc, execOpts)
+	if err != nil {
+		return nil, errorf("failed to create attach options: %w", err)
+	}
+	if execOpts == nil {
+		execOpts = new(ExecOptions)
+	}
+	// The exec helper is only available within the container mount namespace.
+	useHelper := opts.Namespaces&unix.CLONE_NEWNS != 0
+	if !useHelper && c.needsExecContext(proc) {
+		return nil, errorf("resource limits, oom_score_adj and no_new_privs require to attach to the container mount namespace")
+	}
+	p := &ExecProcess{pidfd: -1}
+	// The child ends of the stdio pipes (or the pty slave)
+	// are inherited by the attached process.
+	var closeAfterStart []io.Closer
+	defer func() {
+		for _, f := range closeAfterStart {
+			f.Close()
+		}
+	}()
+
+	if proc.Terminal {
+		if execOpts.Stdin != nil || execOpts.Stdout != nil || execOpts.Stderr != nil {
+			return nil, errorf("stdio can not be set if a terminal is allocated")
+		}
+		tty, err := attachTerminal(&opts, proc, execOpts)
+		if err != nil {
+			return nil, errorf("failed to setup terminal: %w", err)
+		}
+		closeAfterStart = append(closeAfterStart, tty)
+	} else {
+		closeAfterStart, err = p.setupStdio(&opts, execOpts)
+		if err != nil {
+			p.closeStdio()
+			return nil, errorf("failed to setup stdio: %w", err)
+		}
+	}
+
+	if execOpts.SessionID != "" {
+		p.c = c
+		p.session = &ExecSession{ID: execOpts.SessionID, Args: proc.Args, CreatedAt: time.Now()}
+		if err := c.createExecSession(p.session); err != nil {
+			p.closeStdio()
+			return nil, errorf("failed to create exec session: %w", err)
+		}
+	}
+
+	args := proc.Args
+	// helperFiles are the child ends of the exec helper pipes.
+	var helperFiles []*os.File
+	var errPipe, syncPipe *os.File
+	if useHelper {
+		var errPipeChild *os.File
+		errPipe, errPipeChild, err = os.Pipe()
+		if err != nil {
+			p.closeStdio()
+			return nil, errorf("failed to create exec error pipe: %w", err)
+		}
+		defer errPipe.Close()
+		closeAfterStart = append(closeAfterStart, errPipeChild)
+		helperFiles = append(helperFiles, errPipeChild)
+
+		var syncPipeChild *os.File
+		syncPipeChild, syncPipe, err = os.Pipe()
+		if err != nil {
+			p.closeStdio()
+			return nil, errorf("failed to create exec sync pipe: %w", err)
+		}
+		// The exec helper exits if the sync pipe is closed before
+		// the runtime has written to it.
+		defer syncPipe.Close()
+		closeAfterStart = append(closeAfterStart, syncPipeChild)
+		helperFiles = append(helperFiles, syncPipeChild)
+		helperArgs := []string{execHelper, "exec", "-syncfd", strconv.Itoa(int(syncPipeChild.Fd()))}
+		// liblxc sets no_new_privs if it is set for the container.
+		if proc.NoNewPrivileges && !c.Spec.Process.NoNewPrivileges {
+			helperArgs = append(helperArgs, "-no-new-privs")
+		}
+		args = append(append(helperArgs, strconv.Itoa(int(errPipeChild.Fd()))), proc.Args...)
+	}
+
+	err = func() (err error) {
+		execContextMu.Lock()
+		defer execContextMu.Unlock()
+		if execOpts.PreserveFds > 0 {
+			restore, err := inheritFds(execOpts.PreserveFds)
+			if err != nil {
+				return fmt.Errorf("failed to preserve file descriptors: %w", err)
+			}
+			defer func() {
+				if err := restore(); err != nil {
+					c.Log.Warn().Msgf("%s", err)
+				}
+			}()
+		}
+		if len(helperFiles) == 0 {
+			p.Pid, err = c.LinuxContainer.RunCommandNoWait(args, opts)
+			return err
+		}
+		// The child ends of the helper pipes must be inherited by the attached process.
+		// syscall.ForkLock keeps them from being inherited by processes forked
+		// concurrently by the Go runtime, but not by processes that liblxc
+		// forks through cgo. So the exec error pipe might be held open by
+		// other processes and waitExec detects the exec by the changed
+		// executable of the process.
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+		for _, f := range helperFiles {
+			if _, err := unix.FcntlInt(f.Fd(), unix.F_SETFD, 0); err != nil {
+				return fmt.Errorf("failed to clear close-on-exec flag of exec helper pipe: %w", err)
+			}
+		}
+		p.Pid, err = c.LinuxContainer.RunCommandNoWait(args, opts)
+		for _, f := range helperFiles {
+			f.Close()
+		}
+		return err
+	}()
+	for _, f := range closeAfterStart {
+		f.Close()
+	}
+	closeAfterStart = nil
+	if err != nil {
+		p.closeStdio()
+		if p.session != nil {
+			os.Remove(c.execSessionPath(p.session.ID))
+		}
+		return nil, errorf("failed to run exec cmd: %w", err)
+	}
+
+	if p.session != nil {
+		p.session.Pid = p.Pid
+		// Without start time the session process can not be signaled safely.
+		p.session.PidStartTime, err = processStartTime(p.Pid)
+		if err != nil {
+			// #nosec
+			p.Signal(unix.SIGKILL)
+			// #nosec
+			p.Wait(context.Background())
+			return nil, errorf("failed to get start time of exec process %d: %w", p.Pid, err)
+		}
+		if err := c.writeExecSession(p.session, false); err != nil {
+			c.Log.Warn().Msgf("failed to update exec session %q: %s", p.session.ID, err)
+		}
+	}
+
+	// The attached process is a child of the calling process and
+	// can not be reaped by anyone else, so the pid can not be reused.
+	p.pidfd, err = pidfdOpen(p.Pid)
+	if err != nil && err != unix.ENOSYS {
+		c.Log.Warn().Msgf("pidfd_open for exec process %d failed: %s", p.Pid, err)
+	}
+
+	if errPipe != nil {
+		// Blocks until the process is executed, the exec failed or the timeout expired.
+		err := p.waitExec(int(errPipe.Fd()), syncPipe, proc, execTimeout)
+		if err != nil {
+			// The exec helper exits if the exec failed.
+			// #nosec
+			p.Signal(unix.SIGKILL)
+			// #nosec
+			p.Wait(context.Background())
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Messages written by the exec helper to the exec error pipe (see cmd/lxcri-init).
+// A message is the message type byte followed by
+// the payload length byte and the payload.
+const (
+	// execMsgStarted is written when the exec helper is started.
+	execMsgStarted = 's'
+	// execMsgError is written if the exec fails.
+	// The payload is the decimal errno value.
+	execMsgError = 'e'
+)
+
+// execTimeout is the maximum time StartExec waits for the exec helper
+// to execute the process.
+const execTimeout = time.Second * 10
+
+// execPollInterval is the interval in which waitExec checks
+// whether the exec helper has executed the process.
+const execPollInterval = time.Millisecond * 10
+
+var (
+	errExecTimeout = fmt.Errorf("timeout waiting for the exec helper")
+	errExecExited  = fmt.Errorf("exec process has exited")
+)
+
+// waitExec waits until the exec helper has executed the process.
+// The read end fd of the exec error pipe receives the messages of the exec helper.
+// When the exec helper is started, the resource limits and the OOM score are applied
+// and the exec helper is notified through syncPipe.
+// ErrExecNotFound or ErrExecPermission are returned if the exec failed.
+// If the exec helper was not started, nil is returned and the
+// exec error is only reflected by the exit status of the process.
+//
+// The exec is detected when the error pipe is closed on exec,
+// or when the executable of the process has changed, because the pipe
+// might be held open by processes that liblxc forked concurrently.
+func (p *ExecProcess) waitExec(fd int, syncPipe *os.File, proc *specs.Process, timeout time.Duration) error {
+	r := &execMessageReader{fd: fd, pidfd: p.pidfd}
+	deadline := time.Now().Add(timeout)
+
+	typ, _, err := r.next(deadline, nil)
+	if err == io.EOF || err == errExecExited {
+		return nil
+	}
+	if err != nil {
+		return errorf("exec process %d: %w", p.Pid, err)
+	}
+	if typ != execMsgStarted {
+		return errorf("unexpected exec helper message type %q", typ)
+	}
+
+	// The exec helper waits for the sync pipe.
+	exePath := fmt.Sprintf("/proc/%d/exe", p.Pid)
+	helper, err := os.Stat(exePath)
+	if err != nil {
+		return errorf("failed to stat exec helper: %w", err)
+	}
+	if err := setExecContext(p.Pid, proc); err != nil {
+		return errorf("failed to set exec process attributes: %w", err)
+	}
+	if _, err := syncPipe.Write([]byte{0}); err != nil {
+		return errorf("failed to write exec sync pipe: %w", err)
+	}
+
+	executed := func() bool {
+		exe, err := os.Stat(exePath)
+		return err == nil && !os.SameFile(helper, exe)
+	}
+	typ, payload, err := r.next(deadline, executed)
+	if err == io.EOF || err == errExecExited {
+		return nil
+	}
+	if err != nil {
+		return errorf("exec process %d: %w", p.Pid, err)
+	}
+	switch typ {
+	case 0:
+		return nil
+	case execMsgError:
+		return execError(payload, proc.Args[0])
+	}
+	return errorf("unexpected exec helper message type %q", typ)
+}
+
+// execMessageReader reads the messages of the exec helper from the exec error pipe.
+type execMessageReader struct {
+	// fd is the read end of the exec error pipe.
+	fd int
+	// pidfd refers to the exec process, it is -1 if pidfd_open is not supported.
+	pidfd int
+	data  []byte
+}
+
+// next returns the next message from the exec error pipe.
+// It returns io.EOF if the pipe is closed, errExecExited if the process has exited
+// and errExecTimeout if the deadline is reached.
+// If done is not nil, it is called in intervals of execPollInterval while
+// no message is available. A message type of 0 is returned if done returns true.
+func (r *execMessageReader) next(deadline time.Time, done func() bool) (byte, []byte, error) {
+	fds := []unix.PollFd{{Fd: int32(r.fd), Events: unix.POLLIN}}
+	if r.pidfd >= 0 {
+		fds = append(fds, unix.PollFd{Fd: int32(r.pidfd), Events: unix.POLLIN})
+	}
+	buf := make([]byte, 512)
+	for {
+		if len(r.data) >= 2 && len(r.data) >= 2+int(r.data[1]) {
+			typ, payload := r.data[0], r.data[2:2+int(r.data[1])]
+			r.data = r.data[2+int(r.data[1]):]
+			return typ, payload, nil
+		}
+
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return 0, nil, errExecTimeout
+		}
+		if done != nil && timeout > execPollInterval {
+			timeout = execPollInterval
+		}
+		n, err := unix.Poll(fds, int(timeout.Milliseconds())+1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to poll exec error pipe: %w", err)
+		}
+		if n == 0 {
+			// Pending messages are read before done is called.
+			if done != nil && done() {
+				return 0, nil, nil
+			}
+			continue
+		}
+
+		if fds[0].Revents != 0 {
+			n, err := unix.Read(r.fd, buf)
+			if err == unix.EINTR || err == unix.EAGAIN {
+				continue
+			}
+			if err != nil {
+				return 0, nil, fmt.Errorf("failed to read exec error pipe: %w", err)
+			}
+			if n == 0 {
+				return 0, nil, io.EOF
+			}
+			r.data = append(r.data, buf[:n]...)
+			// Read all pending messages before the process exit is handled.
+			continue
+		}
+		if len(fds) > 1 && fds[1].Revents != 0 {
+			return 0, nil, errExecExited
+		}
+	}
+}
+
+func execError(payload []byte, cmd string) error {
+	n, err := strconv.Atoi(string(payload))
+	if err != nil {
+		return errorf("invalid exec error %q", payload)
+	}
+	errno := unix.Errno(n)
+	switch errno {
+	case unix.ENOENT:
+		return fmt.Errorf("%w: %q", ErrExecNotFound, cmd)
+	case unix.EACCES, unix.EPERM:
+		return fmt.Errorf("%w: %q", ErrExecPermission, cmd)
+	}
+	return errorf("failed to execute %q: %w", cmd, errno)
+}
+
+// setupStdio sets the stdio file descriptors in opts.
+// It returns the child ends of the created pipes,
+// which must be closed after the process was started.
+func (p *ExecProcess) setupStdio(opts *lxc.AttachOptions, execOpts *ExecOptions) ([]io.Closer, error) {
+	var childFiles []io.Closer
+
+	if r := execOpts.Stdin; r != nil {
+		if f, ok := r.(*os.File); ok {
+			opts.StdinFd = f.Fd()
+		} else {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				return childFiles, err
+			}
+			childFiles = append(childFiles, pr)
+			wc := &closeOnce{File: pw}
+			p.closeAfterWait = append(p.closeAfterWait, wc)
+			opts.StdinFd = pr.Fd()
+			// The copying is not awaited, since reading from r might block forever.
+			go func() {
+				// #nosec
+				io.Copy(wc, r)
+				wc.Close()
+			}()
+		}
+	}
+
+	outputs := []struct {
+		w  io.Writer
+		fd *uintptr
+	}{
+		{execOpts.Stdout, &opts.StdoutFd},
+		{execOpts.Stderr, &opts.StderrFd},
+	}
+	for _, out := range outputs {
+		if out.w == nil {
+			continue
+		}
+		if f, ok := out.w.(*os.File); ok {
+			*out.fd = f.Fd()
+			continue
+		}
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return childFiles, err
+		}
+		childFiles = append(childFiles, pw)
+		p.closeAfterWait = append(p.closeAfterWait, pr)
+		*out.fd = pw.Fd()
+		p.copying.Add(1)
+		go func(w io.Writer) {
+			defer p.copying.Done()
+			// #nosec
+			io.Copy(w, pr)
+		}(out.w)
+	}
+	return childFiles, nil
+}
+
+// closeOnce closes the file only once, because the write end of the
+// stdin pipe is closed either by the copying goroutine or by closeStdio.
+type closeOnce struct {
+	*os.File
+	once sync.Once
+	err  error
+}
+
+func (c *closeOnce) Close() error {
+	c.once.Do(func() {
+		c.err = c.File.Close()
+	})
+	return c.err
+}
+
+func (p *ExecProcess) closeStdio() {
+	for _, f := range p.closeAfterWait {
+		f.Close()
+	}
+}
+
+// Signal sends the signal sig to the process.
+// It returns an error if the process has already been reaped.
+func (p *ExecProcess) Signal(sig unix.Signal) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.exited {
+		return errorf("exec process %d has already exited", p.Pid)
+	}
+	if p.pidfd >= 0 {
+		return pidfdSendSignal(p.pidfd, sig)
+	}
+	return unix.Kill(p.Pid, sig)
+}
+
+// execWaitDelay is the time ExecProcess.Wait waits for the output to be copied
+// after the process was killed because the context is done.
+const execWaitDelay = time.Second
+
+// Wait waits for the process to exit and returns its exit status.
+// If the process was terminated by a signal the exit status is 128 + signal number.
+// If the context is done before the process exits, the process is killed
+// and the context error is returned along with the exit status.
+// Wait waits for all output to be copied to the Stdout and Stderr writers.
+// If the process was killed, the copying is stopped after execWaitDelay.
+func (p *ExecProcess) Wait(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	if p.waited || p.exited {
+		p.mu.Unlock()
+		return -1, errorf("wait for exec process %d was already called", p.Pid)
+	}
+	p.waited = true
+	p.mu.Unlock()
+
+	type result struct {
+		ws  unix.WaitStatus
+		err error
+	}
+	waitc := make(chan result, 1)
+	go func() {
+		var r result
+		for {
+			_, r.err = unix.Wait4(p.Pid, &r.ws, 0, nil)
+			if r.err != unix.EINTR {
+				break
+			}
+		}
+		// Mark the process as exited before the PID can be reused.
+		p.mu.Lock()
+		p.exited = true
+		if p.pidfd >= 0 {
+			unix.Close(p.pidfd)
+			p.pidfd = -1
+		}
+		p.mu.Unlock()
+		waitc <- r
+	}()
+
+	var r result
+	var ctxErr error
+	select {
+	case r = <-waitc:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+		// The process might have exited in the meantime.
+		// #nosec
+		p.Signal(unix.SIGKILL)
+		r = <-waitc
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		p.copying.Wait()
+		close(copied)
+	}()
+	if ctxErr != nil {
+		select {
+		case <-copied:
+		case <-time.After(execWaitDelay):
+			// The output pipes are held open by other processes
+			// that inherited them from the killed process.
+			// Closing the read ends stops the copying.
+			p.closeStdio()
+			<-copied
+		}
+	} else {
+		<-copied
+	}
+	p.closeStdio()
+
+	if r.err != nil {
+		return -1, errorf("failed to wait for exec process %d: %w", p.Pid, r.err)
+	}
+	exitStatus := r.ws.ExitStatus()
+	if r.ws.Signaled() {
+		exitStatus = 128 + int(r.ws.Signal())
+	}
+	if p.session != nil {
+		finishedAt := time.Now()
+		p.session.ExitStatus = &exitStatus
+		p.session.FinishedAt = &finishedAt
+		if err := p.c.writeExecSession(p.session, false); err != nil {
+			p.c.Log.Warn().Msgf("failed to record exit status of exec session %q: %s", p.session.ID, err)
+		}
+	}
+	return exitStatus, ctxErr
+}
+
+// Release releases the process handle without waiting for the process.
+// The process continues to run. The exit status of the process
+// is not recorded in the exec session (see ExecSession.ExitStatus).
+func (p *ExecProcess) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.exited = true
+	if p.pidfd >= 0 {
+		unix.Close(p.pidfd)
+		p.pidfd = -1
+	}
+	p.closeStdio()
+}
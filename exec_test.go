@@ -0,0 +1,371 @@
+package lxcri
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+func TestCheckExecCapabilities(t *testing.T) {
+	containerCaps := &specs.LinuxCapabilities{
+		Permitted: []string{"CAP_CHOWN", "CAP_KILL"},
+	}
+
+	require.NoError(t, checkExecCapabilities(nil, containerCaps))
+
+	caps := &specs.LinuxCapabilities{
+		Bounding:  []string{"CAP_CHOWN", "CAP_KILL"},
+		Effective: []string{"cap_kill"},
+		Permitted: []string{"CAP_CHOWN", "kill"},
+	}
+	require.NoError(t, checkExecCapabilities(caps, containerCaps))
+
+	caps.Ambient = []string{"CAP_SYS_ADMIN"}
+	err := checkExecCapabilities(caps, containerCaps)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not granted")
+
+	caps.Ambient = nil
+	caps.Permitted = []string{"CAP_CHOWN"}
+	err = checkExecCapabilities(caps, containerCaps)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dropping")
+
+	// container without capabilities
+	require.Error(t, checkExecCapabilities(caps, nil))
+	require.NoError(t, checkExecCapabilities(&specs.LinuxCapabilities{}, nil))
+}
+
+func TestCheckExecSecurity(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: &specs.Spec{
+		Process: &specs.Process{
+			NoNewPrivileges: true,
+			SelinuxLabel:    "system_u:system_r:container_t:s0",
+		},
+	}}}
+
+	require.NoError(t, c.checkExecSecurity(&specs.Process{NoNewPrivileges: true}))
+
+	err := c.checkExecSecurity(&specs.Process{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no_new_privs")
+
+	proc := &specs.Process{NoNewPrivileges: true, SelinuxLabel: c.Spec.Process.SelinuxLabel}
+	require.NoError(t, c.checkExecSecurity(proc))
+	proc.SelinuxLabel = "system_u:system_r:spc_t:s0"
+	require.Error(t, c.checkExecSecurity(proc))
+
+	proc = &specs.Process{
+		NoNewPrivileges: true,
+		Rlimits: []specs.POSIXRlimit{
+			{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024},
+			{Type: "RLIMIT_NPROC", Soft: 100, Hard: 100},
+		},
+	}
+	require.NoError(t, c.checkExecSecurity(proc))
+
+	proc.Rlimits = append(proc.Rlimits, specs.POSIXRlimit{Type: "rlimit_nofile"})
+	err = c.checkExecSecurity(proc)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "duplicate")
+
+	proc.Rlimits = []specs.POSIXRlimit{{Type: "RLIMIT_FOO"}}
+	err = c.checkExecSecurity(proc)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported")
+}
+
+func TestSetExecContext(t *testing.T) {
+	var orig unix.Rlimit
+	require.NoError(t, unix.Getrlimit(unix.RLIMIT_NOFILE, &orig))
+	origScore, err := os.ReadFile("/proc/self/oom_score_adj")
+	require.NoError(t, err)
+
+	pid, err := syscall.ForkExec("/bin/sleep", []string{"sleep", "10"}, &syscall.ProcAttr{})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, unix.Kill(pid, unix.SIGKILL))
+		_, err := unix.Wait4(pid, nil, 0, nil)
+		require.NoError(t, err)
+	}()
+
+	// increasing the OOM score does not require privileges
+	score := 1000
+	proc := &specs.Process{
+		Rlimits:     []specs.POSIXRlimit{{Type: "RLIMIT_NOFILE", Soft: 16, Hard: orig.Max}},
+		OOMScoreAdj: &score,
+	}
+	require.NoError(t, setExecContext(pid, proc))
+
+	var limit unix.Rlimit
+	require.NoError(t, prlimit(pid, unix.RLIMIT_NOFILE, nil, &limit))
+	require.Equal(t, unix.Rlimit{Cur: 16, Max: orig.Max}, limit)
+	val, err := os.ReadFile(fmt.Sprintf("/proc/%d/oom_score_adj", pid))
+	require.NoError(t, err)
+	require.Equal(t, "1000", strings.TrimSpace(string(val)))
+
+	// the calling process is not changed
+	require.NoError(t, unix.Getrlimit(unix.RLIMIT_NOFILE, &limit))
+	require.Equal(t, orig, limit)
+	val, err = os.ReadFile("/proc/self/oom_score_adj")
+	require.NoError(t, err)
+	require.Equal(t, origScore, val)
+}
+
+func TestNeedsExecContext(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: &specs.Spec{Process: &specs.Process{}}}}
+	require.False(t, c.needsExecContext(&specs.Process{}))
+	require.True(t, c.needsExecContext(&specs.Process{NoNewPrivileges: true}))
+	require.True(t, c.needsExecContext(&specs.Process{Rlimits: []specs.POSIXRlimit{{Type: "RLIMIT_NOFILE"}}}))
+
+	// no_new_privs of the container is set by liblxc
+	c.Spec.Process.NoNewPrivileges = true
+	require.False(t, c.needsExecContext(&specs.Process{NoNewPrivileges: true}))
+}
+
+func TestInheritFds(t *testing.T) {
+	isCloexec := func(fd int) bool {
+		flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+		require.NoError(t, err)
+		return flags&unix.FD_CLOEXEC != 0
+	}
+
+	f, err := os.Open("/dev/null")
+	require.NoError(t, err)
+	defer f.Close()
+
+	// ensure that the file descriptors to preserve are open
+	n := 4
+	for fd := 3; fd < 3+n; fd++ {
+		if _, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0); err == unix.EBADF {
+			require.NoError(t, unix.Dup3(int(f.Fd()), fd, unix.O_CLOEXEC))
+			defer unix.Close(fd)
+		}
+		// restore the close-on-exec flag
+		defer unix.FcntlInt(uintptr(fd), unix.F_SETFD, unix.FD_CLOEXEC)
+	}
+
+	leaked, err := os.Open("/dev/null")
+	require.NoError(t, err)
+	defer leaked.Close()
+	require.True(t, int(leaked.Fd()) >= 3+n)
+	_, err = unix.FcntlInt(leaked.Fd(), unix.F_SETFD, 0)
+	require.NoError(t, err)
+
+	restore, err := inheritFds(n)
+	require.NoError(t, err)
+	for fd := 3; fd < 3+n; fd++ {
+		require.False(t, isCloexec(fd), "fd %d", fd)
+	}
+	require.True(t, isCloexec(int(leaked.Fd())))
+
+	require.NoError(t, restore())
+	for fd := 3; fd < 3+n; fd++ {
+		require.True(t, isCloexec(fd), "fd %d", fd)
+	}
+	require.False(t, isCloexec(int(leaked.Fd())))
+
+	_, err = inheritFds(-1)
+	require.Error(t, err)
+}
+
+// startExecProcess starts the given command with the stdio from execOpts
+// like StartExec, but without liblxc.
+func startExecProcess(t *testing.T, execOpts *ExecOptions, args ...string) *ExecProcess {
+	opts := lxc.AttachOptions{StdinFd: 0, StdoutFd: 1, StderrFd: 2}
+	p := &ExecProcess{pidfd: -1}
+	childFiles, err := p.setupStdio(&opts, execOpts)
+	require.NoError(t, err)
+	defer func() {
+		for _, f := range childFiles {
+			f.Close()
+		}
+	}()
+
+	attr := &syscall.ProcAttr{Files: []uintptr{opts.StdinFd, opts.StdoutFd, opts.StderrFd}}
+	p.Pid, err = syscall.ForkExec(args[0], args, attr)
+	require.NoError(t, err)
+	p.pidfd, _ = pidfdOpen(p.Pid)
+	return p
+}
+
+func TestExecProcessStdio(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	execOpts := &ExecOptions{
+		Stdin:  strings.NewReader("hello"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	p := startExecProcess(t, execOpts, "/bin/sh", "-c", "cat; echo world >&2; exit 3")
+	status, err := p.Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, status)
+	require.Equal(t, "hello", stdout.String())
+	require.Equal(t, "world\n", stderr.String())
+
+	_, err = p.Wait(context.Background())
+	require.Error(t, err)
+	require.Error(t, p.Signal(unix.SIGTERM))
+}
+
+func TestExecProcessSignal(t *testing.T) {
+	p := startExecProcess(t, &ExecOptions{}, "/bin/sleep", "10")
+
+	// the exit status is recorded in the exec session
+	p.c = &Container{ContainerConfig: &ContainerConfig{}, runtimeDir: t.TempDir()}
+	p.session = &ExecSession{ID: "s1", Pid: p.Pid}
+	require.NoError(t, p.c.createExecSession(p.session))
+
+	require.NoError(t, p.Signal(unix.SIGTERM))
+	status, err := p.Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 128+int(unix.SIGTERM), status)
+
+	s, err := p.c.ExecSession("s1")
+	require.NoError(t, err)
+	require.NotNil(t, s.ExitStatus)
+	require.Equal(t, status, *s.ExitStatus)
+	require.NotNil(t, s.FinishedAt)
+}
+
+func TestExecProcessWaitCancel(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	require.NoError(t, err)
+	defer f.Close()
+
+	p := startExecProcess(t, &ExecOptions{Stdout: f}, "/bin/sh", "-c", "echo started; exec sleep 10")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	status, err := p.Wait(ctx)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "%s", err)
+	require.Equal(t, 128+int(unix.SIGKILL), status)
+
+	out, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, "started\n", string(out))
+}
+
+func TestExecProcessWaitCancelOutputHeld(t *testing.T) {
+	var stdout bytes.Buffer
+	// the background process keeps the stdout pipe open
+	p := startExecProcess(t, &ExecOptions{Stdout: &stdout}, "/bin/sh", "-c", "sleep 2 & echo started; exec sleep 10")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	start := time.Now()
+	status, err := p.Wait(ctx)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "%s", err)
+	require.Equal(t, 128+int(unix.SIGKILL), status)
+	require.True(t, time.Since(start) < execWaitDelay+time.Millisecond*500)
+	require.Equal(t, "started\n", stdout.String())
+}
+
+func TestExecMessageReader(t *testing.T) {
+	nextMsg := func(msg string) (byte, []byte, error) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		defer r.Close()
+		_, err = w.Write([]byte(msg))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		mr := &execMessageReader{fd: int(r.Fd()), pidfd: -1}
+		return mr.next(time.Now().Add(time.Second), nil)
+	}
+
+	_, _, err := nextMsg("")
+	require.Equal(t, io.EOF, err)
+
+	typ, payload, err := nextMsg("e\x0213")
+	require.NoError(t, err)
+	require.Equal(t, byte(execMsgError), typ)
+	require.Equal(t, "13", string(payload))
+
+	// incomplete message
+	_, _, err = nextMsg("e\x02")
+	require.Equal(t, io.EOF, err)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+	_, err = w.Write([]byte("s\x00e\x012"))
+	require.NoError(t, err)
+
+	mr := &execMessageReader{fd: int(r.Fd()), pidfd: -1}
+	deadline := time.Now().Add(time.Millisecond * 100)
+	typ, _, err = mr.next(deadline, nil)
+	require.NoError(t, err)
+	require.Equal(t, byte(execMsgStarted), typ)
+
+	typ, payload, err = mr.next(deadline, func() bool { return true })
+	require.NoError(t, err)
+	require.Equal(t, byte(execMsgError), typ)
+	require.Equal(t, "2", string(payload))
+
+	typ, _, err = mr.next(deadline, func() bool { return true })
+	require.NoError(t, err)
+	require.Equal(t, byte(0), typ)
+
+	_, _, err = mr.next(deadline, nil)
+	require.Equal(t, errExecTimeout, err)
+}
+
+// startExecHelper simulates the exec helper with a shell script.
+// The script can use fd 3 as the write end of the error pipe and
+// fd 4 as the read end of the sync pipe.
+func startExecHelper(t *testing.T, script string) (*ExecProcess, *os.File, *os.File) {
+	errPipe, errPipeChild, err := os.Pipe()
+	require.NoError(t, err)
+	syncPipeChild, syncPipe, err := os.Pipe()
+	require.NoError(t, err)
+
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.ExtraFiles = []*os.File{errPipeChild, syncPipeChild}
+	require.NoError(t, cmd.Start())
+	syncPipeChild.Close()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		errPipe.Close()
+		syncPipe.Close()
+	})
+
+	p := &ExecProcess{Pid: cmd.Process.Pid, pidfd: -1}
+	// errPipeChild is held open, like by processes that liblxc forks concurrently.
+	t.Cleanup(func() { errPipeChild.Close() })
+	return p, errPipe, syncPipe
+}
+
+func TestWaitExec(t *testing.T) {
+	proc := &specs.Process{Args: []string{"cmd"}}
+
+	// The exec is detected by the changed executable.
+	p, errPipe, syncPipe := startExecHelper(t, "printf 's\\000' >&3; head -c1 <&4 >/dev/null; exec sleep 10")
+	require.NoError(t, p.waitExec(int(errPipe.Fd()), syncPipe, proc, time.Second*5))
+
+	p, errPipe, syncPipe = startExecHelper(t, "printf 's\\000' >&3; head -c1 <&4 >/dev/null; printf 'e\\001%s' 2 >&3; exit 127")
+	err := p.waitExec(int(errPipe.Fd()), syncPipe, proc, time.Second*5)
+	require.True(t, errors.Is(err, ErrExecNotFound), "%s", err)
+
+	p, errPipe, syncPipe = startExecHelper(t, "printf 's\\000' >&3; head -c1 <&4 >/dev/null; printf 'e\\002%s' 13 >&3; exit 126")
+	err = p.waitExec(int(errPipe.Fd()), syncPipe, proc, time.Second*5)
+	require.True(t, errors.Is(err, ErrExecPermission), "%s", err)
+
+	// The helper is not executed in time.
+	p, errPipe, syncPipe = startExecHelper(t, "printf 's\\000' >&3; head -c1 <&4 >/dev/null; while true; do sleep 1; done")
+	err = p.waitExec(int(errPipe.Fd()), syncPipe, proc, time.Millisecond*200)
+	require.True(t, errors.Is(err, errExecTimeout), "%s", err)
+}
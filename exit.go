@@ -0,0 +1,217 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"golang.org/x/sys/unix"
+)
+
+// Files within the container runtime directory that are used
+// to determine the exit status of the container process.
+const (
+	// exitStatusFile is written by the monitor process (lxcri-start).
+	exitStatusFile = "exitstatus"
+	// memoryEventsFile is copied from the container cgroup by the liblxc stop hook.
+	memoryEventsFile = "memory.events"
+	// initErrorFile contains the error message that lxcri-init reported
+	// over the sync fifo (see Container.checkInitError).
+	initErrorFile = "initerror"
+	// exitFile is the recorded ExitStatus.
+	exitFile = "exit.json"
+)
+
+// Exit reasons, the values match the reasons used by kubernetes where applicable.
+const (
+	ExitReasonCompleted  = "Completed"
+	ExitReasonError      = "Error"
+	ExitReasonSignaled   = "Signaled"
+	ExitReasonOOMKilled  = "OOMKilled"
+	ExitReasonInitFailed = "InitFailed"
+)
+
+// TerminationMessagePathAnnotation is the annotation that contains
+// the path to the kubernetes container termination log.
+const TerminationMessagePathAnnotation = "io.kubernetes.container.terminationMessagePath"
+
+// ExitStatus is the exit status of the container init process.
+type ExitStatus struct {
+	// ExitCode is the exit code of the init process.
+	// If the process was terminated by a signal the ExitCode is 128 + signal number.
+	ExitCode int `json:"exitCode"`
+	// Signal is the signal that terminated the init process.
+	Signal unix.Signal `json:"signal,omitempty"`
+	// FinishedAt is the time the init process has exited.
+	FinishedAt time.Time `json:"finishedAt"`
+	// OOMKilled is true if the OOM killer killed any process within the container cgroup.
+	OOMKilled bool `json:"oomKilled"`
+	// Reason is one of the ExitReason* values.
+	Reason string `json:"reason"`
+	// Message is the error message if lxcri-init failed.
+	// The message is reported from within the container and is untrusted.
+	Message string `json:"message,omitempty"`
+}
+
+// ExitStatus returns the exit status of the container init process.
+// If the init process has not exited yet, nil is returned.
+// The exit status is recorded in the runtime directory when
+// it is retrieved for the first time. Subsequent calls return
+// the recorded exit status.
+func (c *Container) ExitStatus() (*ExitStatus, error) {
+	status := new(ExitStatus)
+	err := specki.DecodeJSONFile(c.RuntimePath(exitFile), status)
+	if err == nil {
+		return status, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, errorf("failed to load exit status: %w", err)
+	}
+
+	status, err = readExitStatus(c.RuntimePath())
+	if err != nil {
+		return nil, errorf("failed to read exit status: %w", err)
+	}
+	if status == nil {
+		return nil, nil
+	}
+
+	recorded, err := c.recordExitStatus(status)
+	if err != nil {
+		return nil, errorf("failed to record exit status: %w", err)
+	}
+	if recorded {
+		c.writeTerminationLog(status)
+	}
+	return status, nil
+}
+
+// readExitStatus returns the exit status from the files in runtimeDir.
+func readExitStatus(runtimeDir string) (*ExitStatus, error) {
+	data, err := os.ReadFile(filepath.Join(runtimeDir, exitStatusFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ws unix.WaitStatus
+	var sec, nsec int64
+	if _, err := fmt.Sscanf(string(data), "%d %d %d", &ws, &sec, &nsec); err != nil {
+		return nil, fmt.Errorf("invalid exit status %q: %w", data, err)
+	}
+
+	status := &ExitStatus{FinishedAt: time.Unix(sec, nsec).UTC()}
+	if ws.Signaled() {
+		status.Signal = ws.Signal()
+		status.ExitCode = 128 + int(status.Signal)
+	} else {
+		status.ExitCode = ws.ExitStatus()
+	}
+
+	events, err := parseFlatKeyed(filepath.Join(runtimeDir, memoryEventsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	status.OOMKilled = events["oom_kill"] > 0
+
+	msg, err := readInitErrorFile(filepath.Join(runtimeDir, initErrorFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	status.Message = msg
+
+	switch {
+	case status.Message != "":
+		status.Reason = ExitReasonInitFailed
+	case status.ExitCode == 0:
+		status.Reason = ExitReasonCompleted
+	case status.OOMKilled:
+		status.Reason = ExitReasonOOMKilled
+	case status.Signal != 0:
+		status.Reason = ExitReasonSignaled
+	default:
+		status.Reason = ExitReasonError
+	}
+	return status, nil
+}
+
+// readInitErrorFile reads at most maxInitErrorSize bytes from the init error file.
+func readInitErrorFile(filename string) (string, error) {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	msg, err := io.ReadAll(io.LimitReader(f, maxInitErrorSize))
+	return strings.TrimSpace(string(msg)), err
+}
+
+// recordExitStatus writes the exit status to the runtime directory.
+// It returns false if the exit status was already recorded.
+func (c *Container) recordExitStatus(status *ExitStatus) (bool, error) {
+	tmp, err := os.CreateTemp(c.RuntimePath(), "."+exitFile)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(status); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), 0440); err != nil {
+		return false, err
+	}
+	// link fails if the exit status was already recorded
+	err = os.Link(tmp.Name(), c.RuntimePath(exitFile))
+	if os.IsExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// writeTerminationLog writes the exit reason to the kubernetes termination log
+// if the container was OOM killed or terminated by a signal.
+// Messages written by the container (or lxcri-init) are not overwritten.
+func (c *Container) writeTerminationLog(status *ExitStatus) {
+	terminationLog := c.Spec.Annotations[TerminationMessagePathAnnotation]
+	if terminationLog == "" {
+		return
+	}
+
+	var msg string
+	switch status.Reason {
+	case ExitReasonOOMKilled:
+		msg = "container process was killed by the OOM killer"
+	case ExitReasonSignaled:
+		msg = fmt.Sprintf("container process was terminated by signal %s", unix.SignalName(status.Signal))
+	default:
+		return
+	}
+
+	f, err := os.OpenFile(terminationLog, os.O_RDWR|os.O_APPEND, 0640)
+	if err != nil {
+		c.Log.Warn().Msgf("failed to open termination log: %s", err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.Size() > 0 {
+		return
+	}
+	if _, err := fmt.Fprintln(f, msg); err != nil {
+		c.Log.Warn().Msgf("failed to write termination log: %s", err)
+	}
+}
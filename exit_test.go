@@ -0,0 +1,127 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestReadExitStatus(t *testing.T) {
+	dir := t.TempDir()
+
+	status, err := readExitStatus(dir)
+	require.NoError(t, err)
+	require.Nil(t, status)
+
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+
+	// exit code 3
+	write(exitStatusFile, "768 1600000000 5\n")
+	status, err = readExitStatus(dir)
+	require.NoError(t, err)
+	require.Equal(t, &ExitStatus{ExitCode: 3, FinishedAt: time.Unix(1600000000, 5).UTC(), Reason: ExitReasonError}, status)
+
+	// killed by SIGKILL
+	write(exitStatusFile, "9 1600000000 5\n")
+	status, err = readExitStatus(dir)
+	require.NoError(t, err)
+	require.Equal(t, 137, status.ExitCode)
+	require.Equal(t, unix.SIGKILL, status.Signal)
+	require.Equal(t, ExitReasonSignaled, status.Reason)
+
+	write(memoryEventsFile, "oom 1\noom_kill 1\n")
+	status, err = readExitStatus(dir)
+	require.NoError(t, err)
+	require.True(t, status.OOMKilled)
+	require.Equal(t, ExitReasonOOMKilled, status.Reason)
+
+	write(initErrorFile, "exec failed: permission denied\n")
+	status, err = readExitStatus(dir)
+	require.NoError(t, err)
+	require.Equal(t, ExitReasonInitFailed, status.Reason)
+	require.Equal(t, "exec failed: permission denied", status.Message)
+}
+
+func TestReadInitError(t *testing.T) {
+	fifoPath := filepath.Join(t.TempDir(), "syncfifo")
+	require.NoError(t, unix.Mkfifo(fifoPath, 0600))
+
+	// keep the fifo open like the runtime keeps the write end open
+	fd, err := unix.Open(fifoPath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+
+	msg, err := readInitError(fifoPath)
+	require.NoError(t, err)
+	require.Equal(t, "", msg)
+
+	w, err := unix.Open(fifoPath, unix.O_WRONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	require.NoError(t, err)
+	_, err = unix.Write(w, []byte("exec failed: permission denied\n"))
+	require.NoError(t, err)
+	require.NoError(t, unix.Close(w))
+
+	msg, err = readInitError(fifoPath)
+	require.NoError(t, err)
+	require.Equal(t, "exec failed: permission denied", msg)
+
+	// the message size is limited
+	w, err = unix.Open(fifoPath, unix.O_WRONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	require.NoError(t, err)
+	_, err = unix.Write(w, make([]byte, maxInitErrorSize+1))
+	require.NoError(t, err)
+	require.NoError(t, unix.Close(w))
+
+	msg, err = readInitError(fifoPath)
+	require.NoError(t, err)
+	require.Len(t, msg, maxInitErrorSize)
+}
+
+func TestContainerExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	terminationLog := filepath.Join(dir, "termination.log")
+	require.NoError(t, os.WriteFile(terminationLog, nil, 0644))
+
+	c := &Container{
+		ContainerConfig: &ContainerConfig{
+			Spec: &specs.Spec{
+				Annotations: map[string]string{TerminationMessagePathAnnotation: terminationLog},
+			},
+		},
+		runtimeDir: dir,
+	}
+
+	status, err := c.ExitStatus()
+	require.NoError(t, err)
+	require.Nil(t, status)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, exitStatusFile), []byte("9 1600000000 0\n"), 0444))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, memoryEventsFile), []byte("oom_kill 2\n"), 0444))
+
+	status, err = c.ExitStatus()
+	require.NoError(t, err)
+	require.Equal(t, ExitReasonOOMKilled, status.Reason)
+	require.FileExists(t, filepath.Join(dir, exitFile))
+
+	msg, err := os.ReadFile(terminationLog)
+	require.NoError(t, err)
+	require.Equal(t, "container process was killed by the OOM killer\n", string(msg))
+
+	// the recorded exit status does not change
+	require.NoError(t, os.Remove(filepath.Join(dir, memoryEventsFile)))
+	recorded, err := c.ExitStatus()
+	require.NoError(t, err)
+	require.Equal(t, status, recorded)
+
+	// the termination log is written only once
+	msg, err = os.ReadFile(terminationLog)
+	require.NoError(t, err)
+	require.Equal(t, "container process was killed by the OOM killer\n", string(msg))
+}
@@ -0,0 +1,266 @@
+package lxcri
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GCReport lists the orphaned runtime state found by Runtime.GC.
+type GCReport struct {
+	// Containers are the IDs of the containers whose monitor process is gone
+	// without recording an exit status.
+	Containers []string `json:"containers,omitempty"`
+	// RuntimeDirs are the runtime directories of containers that can not be loaded.
+	RuntimeDirs []string `json:"runtimeDirs,omitempty"`
+	// Cgroups are the empty leftover container and monitor cgroups
+	// (relative to the cgroup root).
+	Cgroups []string `json:"cgroups,omitempty"`
+	// LockFiles are the lock files of containers that do not exist.
+	LockFiles []string `json:"lockFiles,omitempty"`
+}
+
+// GC removes the runtime state of orphaned containers.
+// Containers whose monitor process is gone without recording
+// the exit status of the container process are deleted (see Runtime.Delete).
+// Stopped containers with exit status are kept, because the container manager
+// must be able to retrieve the exit status before it deletes the container.
+// Runtime directories of containers that can not be loaded are removed,
+// along with the empty container cgroups configured in the liblxc config file.
+// Empty monitor cgroups (see Runtime.MonitorCgroup) and lock files
+// of containers without runtime directory are removed as well.
+// Cgroups that still contain processes are never removed.
+//
+// If dryRun is true nothing is removed. The returned report
+// lists what was removed (or would have been removed).
+// Errors for single containers are logged and do not stop the collection.
+func (rt *Runtime) GC(ctx context.Context, dryRun bool) (*GCReport, error) {
+	report := new(GCReport)
+
+	ids, err := rt.List()
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, errorf("failed to list containers: %w", err)
+	}
+	for _, id := range ids {
+		if err := rt.gcContainer(ctx, id, dryRun, report); err != nil {
+			if ctx.Err() != nil {
+				return report, err
+			}
+			rt.Log.Warn().Str("cid", id).Msgf("gc failed: %s", err)
+		}
+	}
+
+	// IDs of containers that might have left state behind
+	// after the runtime directory was removed.
+	// The value is true if a lock file exists for the container.
+	leftover := make(map[string]bool)
+	locks, err := readDirNames(filepath.Join(rt.Root, lockDir))
+	if err != nil {
+		return report, errorf("failed to list lock files: %w", err)
+	}
+	for _, id := range locks {
+		leftover[id] = true
+	}
+	if rt.MonitorCgroup != "" {
+		scopes, err := readDirNames(filepath.Join(cgroupRoot, rt.MonitorCgroup))
+		if err != nil {
+			return report, errorf("failed to list monitor cgroups: %w", err)
+		}
+		for _, name := range scopes {
+			if id := strings.TrimSuffix(name, ".scope"); id != name {
+				leftover[id] = leftover[id]
+			}
+		}
+	}
+	for id, hasLockFile := range leftover {
+		if err := rt.gcLeftover(ctx, id, hasLockFile, dryRun, report); err != nil {
+			if ctx.Err() != nil {
+				return report, err
+			}
+			rt.Log.Warn().Str("cid", id).Msgf("gc failed: %s", err)
+		}
+	}
+	return report, nil
+}
+
+func (rt *Runtime) gcContainer(ctx context.Context, id string, dryRun bool, report *GCReport) error {
+	// The lock protects containers that are created concurrently.
+	lock, err := rt.Lock(ctx, id, LockExclusive)
+	if err != nil {
+		return err
+	}
+	removed, err := rt.gcContainerLocked(ctx, id, dryRun, report)
+	if removed && !dryRun {
+		if err := lock.remove(); err != nil {
+			rt.Log.Warn().Str("cid", id).Msgf("failed to remove lock file: %s", err)
+		}
+		return err
+	}
+	lock.Unlock()
+	return err
+}
+
+// gcContainerLocked returns true if the container runtime directory was removed.
+func (rt *Runtime) gcContainerLocked(ctx context.Context, id string, dryRun bool, report *GCReport) (bool, error) {
+	c, err := rt.Load(id)
+	if err == ErrNotExist {
+		return false, nil
+	}
+	if err != nil {
+		dir := filepath.Join(rt.Root, id)
+		rt.Log.Info().Str("cid", id).Msgf("gc unloadable container: %s", err)
+		// The liblxc config file is written before the monitor creates the cgroups.
+		cgroups, err := readLxcConfigItems(filepath.Join(dir, "config"),
+			"lxc.cgroup.dir", "lxc.cgroup.dir.container", "lxc.cgroup.dir.monitor")
+		if err != nil && !os.IsNotExist(err) {
+			rt.Log.Warn().Str("cid", id).Msgf("failed to read lxc config file: %s", err)
+		}
+		report.RuntimeDirs = append(report.RuntimeDirs, dir)
+		if !dryRun {
+			if err := os.RemoveAll(dir); err != nil {
+				return false, err
+			}
+		}
+		for _, cg := range cgroups {
+			if err := gcCgroup(cg, dryRun, report); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	}
+
+	monitorCgroup := c.MonitorCgroupDir
+	running := c.isMonitorRunning()
+	if err := c.Release(); err != nil {
+		return false, err
+	}
+	if running {
+		return false, nil
+	}
+	// The monitor writes the exit status file when the container process exits.
+	_, err = os.Stat(c.RuntimePath(exitStatusFile))
+	if err == nil {
+		return false, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	rt.Log.Info().Str("cid", id).Msgf("gc container with exited monitor process %d", c.Pid)
+	report.Containers = append(report.Containers, id)
+	if !dryRun {
+		if err := rt.delete(ctx, id, true); err != nil {
+			return false, err
+		}
+	}
+	return true, gcCgroup(monitorCgroup, dryRun, report)
+}
+
+// gcLeftover removes the monitor cgroup and the lock file
+// of the container with the given ID if the container does not exist.
+func (rt *Runtime) gcLeftover(ctx context.Context, id string, hasLockFile bool, dryRun bool, report *GCReport) error {
+	lock, err := rt.Lock(ctx, id, LockExclusive)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(filepath.Join(rt.Root, id))
+	if !os.IsNotExist(err) {
+		lock.Unlock()
+		return err
+	}
+
+	if rt.MonitorCgroup != "" {
+		err := gcCgroup(filepath.Join(rt.MonitorCgroup, id+".scope"), dryRun, report)
+		if err != nil {
+			lock.Unlock()
+			return err
+		}
+	}
+
+	// Without lock file the lock file was created by Lock above.
+	if hasLockFile {
+		report.LockFiles = append(report.LockFiles, rt.lockPath(id))
+		if dryRun {
+			return lock.Unlock()
+		}
+	}
+	return lock.remove()
+}
+
+// gcCgroup removes the given cgroup (relative to the cgroup root)
+// if it exists and does not contain any processes.
+func gcCgroup(cgroupDir string, dryRun bool, report *GCReport) error {
+	if cgroupDir == "" {
+		return nil
+	}
+	ev, err := parseCgroupEvents(filepath.Join(cgroupRoot, cgroupDir, "cgroup.events"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ev.populated {
+		return nil
+	}
+	report.Cgroups = append(report.Cgroups, cgroupDir)
+	if dryRun {
+		return nil
+	}
+	return deleteCgroup(cgroupDir)
+}
+
+// readLxcConfigItems returns the values for the given keys
+// from the liblxc config file.
+func readLxcConfigItems(filename string, keys ...string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vals []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// e.g lxc.cgroup.dir.container = kubepods.slice/crio-4711.scope
+		kv := strings.SplitN(sc.Text(), "=", 2)
+		if len(kv) != 2 || !contains(keys, strings.TrimSpace(kv[0])) {
+			continue
+		}
+		if val := strings.TrimSpace(kv[1]); val != "" {
+			vals = append(vals, val)
+		}
+	}
+	return vals, sc.Err()
+}
+
+// readDirNames returns the names of all entries in dir.
+// It returns no error if dir does not exist.
+func readDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
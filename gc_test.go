@@ -0,0 +1,95 @@
+package lxcri
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGC(t *testing.T) {
+	root := cgroupRoot
+	defer func() { cgroupRoot = root }()
+	cgroupRoot = t.TempDir()
+
+	rt := &Runtime{
+		Log:           zerolog.Nop(),
+		Root:          t.TempDir(),
+		MonitorCgroup: "lxcri-monitor.slice",
+	}
+
+	mkcgroup := func(name string, populated bool) {
+		dir := filepath.Join(cgroupRoot, name)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		events := "populated 0\nfrozen 0\n"
+		if populated {
+			events = "populated 1\nfrozen 0\n"
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte(events), 0644))
+	}
+
+	// unloadable container with a liblxc config file
+	brokenDir := filepath.Join(rt.Root, "broken")
+	require.NoError(t, os.Mkdir(brokenDir, 0755))
+	config := "lxc.uts.name = broken\n" +
+		"lxc.cgroup.dir.container = broken.slice\n" +
+		"lxc.cgroup.dir.monitor = lxcri-monitor.slice/broken.scope\n"
+	require.NoError(t, os.WriteFile(filepath.Join(brokenDir, "config"), []byte(config), 0640))
+	mkcgroup("broken.slice", false)
+	mkcgroup("lxcri-monitor.slice/broken.scope", false)
+
+	// leftover lock file and monitor cgroup of a deleted container
+	lock, err := rt.Lock(context.Background(), "gone", LockShared)
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+	mkcgroup("lxcri-monitor.slice/gone.scope", false)
+
+	// monitor cgroup that still contains processes
+	mkcgroup("lxcri-monitor.slice/busy.scope", true)
+
+	report, err := rt.GC(context.Background(), true)
+	require.NoError(t, err)
+	require.Empty(t, report.Containers)
+	require.Equal(t, []string{brokenDir}, report.RuntimeDirs)
+	require.ElementsMatch(t, []string{"broken.slice", "lxcri-monitor.slice/broken.scope", "lxcri-monitor.slice/gone.scope"}, report.Cgroups)
+	require.Equal(t, []string{rt.lockPath("gone")}, report.LockFiles)
+
+	// nothing was removed
+	require.DirExists(t, brokenDir)
+	require.FileExists(t, rt.lockPath("gone"))
+	require.NoFileExists(t, rt.lockPath("busy"))
+
+	// The cgroups of the fake cgroup tree can not be removed with rmdir.
+	require.NoError(t, os.RemoveAll(filepath.Join(cgroupRoot, "broken.slice")))
+	require.NoError(t, os.RemoveAll(filepath.Join(cgroupRoot, "lxcri-monitor.slice/broken.scope")))
+	require.NoError(t, os.RemoveAll(filepath.Join(cgroupRoot, "lxcri-monitor.slice/gone.scope")))
+
+	report, err = rt.GC(context.Background(), false)
+	require.NoError(t, err)
+	require.Equal(t, []string{brokenDir}, report.RuntimeDirs)
+	require.Empty(t, report.Cgroups)
+	require.Equal(t, []string{rt.lockPath("gone")}, report.LockFiles)
+
+	require.NoDirExists(t, brokenDir)
+	require.NoFileExists(t, rt.lockPath("gone"))
+	require.NoFileExists(t, rt.lockPath("broken"))
+	require.NoFileExists(t, rt.lockPath("busy"))
+	require.DirExists(t, filepath.Join(cgroupRoot, "lxcri-monitor.slice/busy.scope"))
+
+	report, err = rt.GC(context.Background(), false)
+	require.NoError(t, err)
+	require.Equal(t, &GCReport{}, report)
+}
+
+func TestReadLxcConfigItems(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	config := "lxc.cgroup.dir = a.slice\n# lxc.cgroup.dir = b.slice\nlxc.cgroup.dir.monitor=c.scope\nlxc.cgroup.dir.container =\n"
+	require.NoError(t, os.WriteFile(filename, []byte(config), 0640))
+
+	vals, err := readLxcConfigItems(filename, "lxc.cgroup.dir", "lxc.cgroup.dir.monitor", "lxc.cgroup.dir.container")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.slice", "c.scope"}, vals)
+}
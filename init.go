@@ -27,6 +27,43 @@ func createFifo(dst string, mode uint32) error {
 	return nil
 }
 
+// maxInitErrorSize is the maximum size of the error message
+// that lxcri-init reports over the sync fifo.
+// It must match the value used by lxcri-init.
+// A single write of up to PIPE_BUF bytes to a pipe is atomic.
+const maxInitErrorSize = 4096
+
+// readInitError reads the error message that lxcri-init writes to the sync fifo
+// if it fails to execute the container process.
+// The caller must keep the write end of the fifo open,
+// otherwise the kernel discards the fifo buffer when lxcri-init exits.
+// A raw non-blocking file descriptor is used, because reading
+// from an os.File would block until the fifo is closed by all writers.
+func readInitError(fifoPath string) (string, error) {
+	fd, err := unix.Open(fifoPath, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+
+	buf := make([]byte, maxInitErrorSize)
+	n := 0
+	for n < len(buf) {
+		r, err := unix.Read(fd, buf[n:])
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.EAGAIN || r == 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		n += r
+	}
+	return strings.TrimSpace(string(buf[:n])), nil
+}
+
 // runAsRuntimeUser returns true if container process is started as runtime user.
 func runAsRuntimeUser(spec *specs.Spec) bool {
 	puid := specki.UnmapContainerID(spec.Process.User.UID, spec.Linux.UIDMappings)
@@ -0,0 +1,145 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// LockMode is the mode of a container lock.
+type LockMode int
+
+const (
+	// LockShared is used for operations that can run concurrently
+	// e.g state, kill, exec.
+	LockShared LockMode = unix.LOCK_SH
+	// LockExclusive is used for operations that modify the container
+	// state or remove the container e.g start, update, delete.
+	LockExclusive LockMode = unix.LOCK_EX
+)
+
+func (m LockMode) String() string {
+	switch m {
+	case LockShared:
+		return "shared"
+	case LockExclusive:
+		return "exclusive"
+	}
+	return fmt.Sprintf("LockMode(%d)", m)
+}
+
+// lockDir is the directory within Runtime.Root that contains the lock files.
+// The lock files can not be placed within the container runtime directory,
+// because it does not exist before create and is removed by delete.
+const lockDir = ".lock"
+
+// lockRetryInterval is the interval for lock acquisition retries.
+var lockRetryInterval = time.Millisecond * 5
+
+// Lock is an advisory (flock) lock for a single container.
+// It serializes runtime operations on the same container,
+// across runtime processes.
+type Lock struct {
+	file *os.File
+	mode LockMode
+}
+
+func (rt *Runtime) lockPath(containerID string) string {
+	return filepath.Join(rt.Root, lockDir, containerID)
+}
+
+// Lock acquires the lock for the container with the given ID in the given mode.
+// Lock blocks until the lock is acquired or the context is done.
+// Runtime.Create and Runtime.Delete acquire the lock in LockExclusive mode,
+// so the lock must not be held by the caller when calling them.
+// The lock must be released with Lock.Unlock.
+func (rt *Runtime) Lock(ctx context.Context, containerID string, mode LockMode) (*Lock, error) {
+	if containerID == "" || strings.ContainsRune(containerID, '/') || containerID[0] == '.' {
+		return nil, errorf("invalid container ID %q", containerID)
+	}
+	p := rt.lockPath(containerID)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return nil, errorf("failed to create lock dir: %w", err)
+	}
+
+	for {
+		f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, errorf("failed to open lock file: %w", err)
+		}
+		if err := flock(ctx, f, mode); err != nil {
+			f.Close()
+			return nil, errorf("failed to acquire %s lock for container %q: %w", mode, containerID, err)
+		}
+		// Delete removes the lock file while it holds the exclusive lock.
+		// Lock again if the acquired lock file was removed.
+		removed, err := isRemoved(f, p)
+		if err != nil {
+			f.Close()
+			return nil, errorf("failed to check lock file: %w", err)
+		}
+		if !removed {
+			return &Lock{file: f, mode: mode}, nil
+		}
+		f.Close()
+	}
+}
+
+// flock acquires the lock on f. Since flock(2) can not be interrupted,
+// the lock is acquired in non-blocking mode and retried until the context is done.
+func flock(ctx context.Context, f *os.File, mode LockMode) error {
+	for {
+		err := unix.Flock(int(f.Fd()), int(mode)|unix.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+		if err != unix.EWOULDBLOCK && err != unix.EINTR {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// isRemoved returns true if f does no longer refer to the file at path p.
+func isRemoved(f *os.File, p string) (bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	pathInfo, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(info, pathInfo), nil
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	return l.file.Close()
+}
+
+// remove removes the lock file and releases the lock.
+// The lock must be held in exclusive mode.
+func (l *Lock) remove() error {
+	if l.mode != LockExclusive {
+		return fmt.Errorf("lock file can only be removed with an exclusive lock")
+	}
+	err := os.Remove(l.file.Name())
+	if err != nil && !os.IsNotExist(err) {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
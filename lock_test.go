@@ -0,0 +1,137 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	ctx := context.Background()
+
+	shared1, err := rt.Lock(ctx, "c1", LockShared)
+	require.NoError(t, err)
+	shared2, err := rt.Lock(ctx, "c1", LockShared)
+	require.NoError(t, err)
+
+	// locks for different containers are independent
+	other, err := rt.Lock(ctx, "c2", LockExclusive)
+	require.NoError(t, err)
+	require.NoError(t, other.Unlock())
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	_, err = rt.Lock(timeoutCtx, "c1", LockExclusive)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "%s", err)
+
+	require.NoError(t, shared1.Unlock())
+	require.NoError(t, shared2.Unlock())
+
+	exclusive, err := rt.Lock(ctx, "c1", LockExclusive)
+	require.NoError(t, err)
+
+	timeoutCtx, cancel = context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	_, err = rt.Lock(timeoutCtx, "c1", LockShared)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "%s", err)
+
+	require.NoError(t, exclusive.Unlock())
+
+	for _, id := range []string{"", ".lock", "../c1", "c1/x"} {
+		_, err = rt.Lock(ctx, id, LockShared)
+		require.Error(t, err, "id:%q", id)
+	}
+}
+
+func TestLockRemove(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	ctx := context.Background()
+
+	exclusive, err := rt.Lock(ctx, "c1", LockExclusive)
+	require.NoError(t, err)
+
+	locked := make(chan *Lock)
+	go func() {
+		l, err := rt.Lock(ctx, "c1", LockExclusive)
+		assert.NoError(t, err)
+		locked <- l
+	}()
+
+	// wait until the lock file was opened by the waiting goroutine
+	time.Sleep(lockRetryInterval * 4)
+	require.NoError(t, exclusive.remove())
+
+	l := <-locked
+	// the waiter must not hold the lock on the removed file
+	info, err := os.Stat(rt.lockPath("c1"))
+	require.NoError(t, err)
+	lockInfo, err := l.file.Stat()
+	require.NoError(t, err)
+	require.True(t, os.SameFile(info, lockInfo))
+	require.NoError(t, l.Unlock())
+
+	shared, err := rt.Lock(ctx, "c1", LockShared)
+	require.NoError(t, err)
+	require.Error(t, shared.remove())
+	require.NoError(t, shared.Unlock())
+}
+
+// TestLockParallel hammers a container lock from parallel goroutines
+// that simulate lifecycle operations, and checks that exclusive operations
+// never overlap with any other operation.
+func TestLockParallel(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+
+	var shared, exclusive int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+				mode := LockShared
+				if (i+j)%4 == 0 {
+					mode = LockExclusive
+				}
+				l, err := rt.Lock(ctx, "c1", mode)
+				cancel()
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				if mode == LockExclusive {
+					n := atomic.AddInt32(&exclusive, 1)
+					assert.Equal(t, int32(1), n, "concurrent exclusive locks")
+					assert.Equal(t, int32(0), atomic.LoadInt32(&shared), "exclusive lock while shared lock is held")
+				} else {
+					atomic.AddInt32(&shared, 1)
+					assert.Equal(t, int32(0), atomic.LoadInt32(&exclusive), "shared lock while exclusive lock is held")
+				}
+
+				time.Sleep(time.Microsecond * 100)
+
+				if mode == LockExclusive {
+					atomic.AddInt32(&exclusive, -1)
+					// simulate delete
+					if j%10 == 0 {
+						assert.NoError(t, l.remove())
+						continue
+					}
+				} else {
+					atomic.AddInt32(&shared, -1)
+				}
+				assert.NoError(t, l.Unlock())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -18,6 +18,10 @@ type namespace struct {
 	CloneFlag int
 }
 
+// TimeNamespace is the namespace type of the time namespace.
+// It is not defined by the runtime-spec version used by lxcri.
+const TimeNamespace specs.LinuxNamespaceType = "time"
+
 var (
 	cgroupNamespace  = namespace{"cgroup", unix.CLONE_NEWCGROUP}
 	ipcNamespace     = namespace{"ipc", unix.CLONE_NEWIPC}
@@ -34,9 +38,9 @@ var (
 		specs.MountNamespace:   mountNamespace,
 		specs.NetworkNamespace: networkNamespace,
 		specs.PIDNamespace:     pidNamespace,
-		// specs.TimeNamespace:     timeNamespace,
-		specs.UserNamespace: userNamespace,
-		specs.UTSNamespace:  utsNamespace,
+		TimeNamespace:          timeNamespace,
+		specs.UserNamespace:    userNamespace,
+		specs.UTSNamespace:     utsNamespace,
 	}
 )
 
@@ -54,6 +58,10 @@ func configureNamespaces(c *Container) error {
 		if !supported {
 			return fmt.Errorf("unsupported namespace %s", ns.Type)
 		}
+		// liblxc supports time namespaces since the lxc.time.offset.* config items were added.
+		if ns.Type == TimeNamespace && !c.supportsConfigItem("lxc.time.offset.boot", "lxc.time.offset.monotonic") {
+			return fmt.Errorf("time namespace is not supported by liblxc")
+		}
 
 		if ns.Path == "" {
 			cloneNamespaces = append(cloneNamespaces, n.Name)
@@ -66,7 +74,61 @@ func configureNamespaces(c *Container) error {
 		}
 	}
 
-	return c.setConfigItem("lxc.namespace.clone", strings.Join(cloneNamespaces, " "))
+	if err := c.setConfigItem("lxc.namespace.clone", strings.Join(cloneNamespaces, " ")); err != nil {
+		return err
+	}
+	return configureTimeOffsets(c)
+}
+
+// TimeOffset is the offset of a clock within the time namespace
+// (see linux.timeOffsets in runtime-spec v1.1).
+type TimeOffset struct {
+	Secs     int64  `json:"secs,omitempty"`
+	Nanosecs uint32 `json:"nanosecs,omitempty"`
+}
+
+func configureTimeOffsets(c *Container) error {
+	if len(c.TimeOffsets) == 0 {
+		return nil
+	}
+	ns := getNamespace(c.Spec, TimeNamespace)
+	if ns == nil {
+		return fmt.Errorf("time offsets require a time namespace")
+	}
+	if ns.Path != "" {
+		return fmt.Errorf("time offsets can not be set for the shared time namespace %s", ns.Path)
+	}
+	for clock, offset := range c.TimeOffsets {
+		key, vals, err := timeOffsetConfig(clock, offset)
+		if err != nil {
+			return err
+		}
+		// liblxc stores the seconds and nanoseconds of the offset separately.
+		for _, val := range vals {
+			if err := c.setConfigItem(key, val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// timeOffsetConfig returns the liblxc config key and values for the given clock offset.
+func timeOffsetConfig(clock string, offset TimeOffset) (string, []string, error) {
+	var key string
+	switch clock {
+	case "monotonic":
+		key = "lxc.time.offset.monotonic"
+	case "boottime":
+		key = "lxc.time.offset.boot"
+	default:
+		return "", nil, fmt.Errorf("unsupported time offset clock %q", clock)
+	}
+	if offset.Nanosecs >= 1e9 {
+		return "", nil, fmt.Errorf("invalid nanoseconds %d for time offset clock %q", offset.Nanosecs, clock)
+	}
+	vals := []string{fmt.Sprintf("%ds", offset.Secs), fmt.Sprintf("%dns", offset.Nanosecs)}
+	return key, vals, nil
 }
 
 func isNamespaceEnabled(spec *specs.Spec, nsType specs.LinuxNamespaceType) bool {
@@ -0,0 +1,25 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeOffsetConfig(t *testing.T) {
+	key, vals, err := timeOffsetConfig("boottime", TimeOffset{Secs: -3600, Nanosecs: 500})
+	require.NoError(t, err)
+	require.Equal(t, "lxc.time.offset.boot", key)
+	require.Equal(t, []string{"-3600s", "500ns"}, vals)
+
+	key, vals, err = timeOffsetConfig("monotonic", TimeOffset{Secs: 10})
+	require.NoError(t, err)
+	require.Equal(t, "lxc.time.offset.monotonic", key)
+	require.Equal(t, []string{"10s", "0ns"}, vals)
+
+	_, _, err = timeOffsetConfig("realtime", TimeOffset{Secs: 10})
+	require.Error(t, err)
+
+	_, _, err = timeOffsetConfig("monotonic", TimeOffset{Nanosecs: 1e9})
+	require.Error(t, err)
+}
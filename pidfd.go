@@ -0,0 +1,156 @@
+package lxcri
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrStalePid is returned if a PID does no longer refer to the tracked process,
+// because the process has exited and the PID was reused by another process.
+var ErrStalePid = fmt.Errorf("stale PID")
+
+// pidfdOpen returns a file descriptor that refers to the process pid.
+// The file descriptor becomes readable when the process has exited.
+// pidfd_open is available since linux 5.3
+func pidfdOpen(pid int) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// pidfdSendSignal sends the signal sig to the process referred to by pidfd.
+// pidfd_send_signal is available since linux 5.1
+func pidfdSendSignal(pidfd int, sig unix.Signal) error {
+	_, _, errno := unix.Syscall6(unix.SYS_PIDFD_SEND_SIGNAL, uintptr(pidfd), uintptr(sig), 0, 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// openPidfd returns a pidfd for the process identified by pid and startTime.
+// The start time check is skipped if startTime is zero.
+// The pidfd pins the process, so a check after pidfd_open
+// can not race with the reuse of pid.
+func openPidfd(pid int, startTime uint64) (int, error) {
+	fd, err := pidfdOpen(pid)
+	if err != nil {
+		return -1, err
+	}
+	if err := checkProcessStartTime(pid, startTime); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// checkProcessStartTime returns ErrStalePid if the start time of
+// the process pid does not match the given startTime.
+// The check is skipped if startTime is zero.
+func checkProcessStartTime(pid int, startTime uint64) error {
+	if startTime == 0 {
+		return nil
+	}
+	st, err := processStartTime(pid)
+	if err != nil {
+		return err
+	}
+	if st != startTime {
+		return fmt.Errorf("%w: process %d has start time %d but expected %d", ErrStalePid, pid, st, startTime)
+	}
+	return nil
+}
+
+// processStartTime returns the time the process pid started after system boot
+// in clock ticks (see field (22) starttime in `man 5 proc`).
+// If the process does not exist, an error that satisfies os.IsNotExist is returned.
+func processStartTime(pid int) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	return parseProcessStartTime(data)
+}
+
+func parseProcessStartTime(stat []byte) (uint64, error) {
+	// The command name (2) is enclosed in parentheses and may contain
+	// any character, so start parsing after the last closing parenthesis.
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid process stat %q", stat)
+	}
+	// fields start with (3) state
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("invalid process stat %q", stat)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// signalCgroupProcess sends the signal sig to the process pid,
+// if it is a member of the cgroup cgroupDir (or one of its sub cgroups).
+// ErrStalePid is returned if the process is not a member of the cgroup.
+// It falls back to kill(2) if pidfds are not supported.
+func signalCgroupProcess(pid int, cgroupDir string, sig unix.Signal) error {
+	fd, err := pidfdOpen(pid)
+	if err == unix.ENOSYS {
+		return unix.Kill(pid, sig)
+	}
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	isMember, err := isCgroupMember(pid, cgroupDir)
+	if os.IsNotExist(err) {
+		return unix.ESRCH
+	}
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return fmt.Errorf("%w: process %d is not a member of cgroup %s", ErrStalePid, pid, cgroupDir)
+	}
+
+	err = pidfdSendSignal(fd, sig)
+	if err == unix.ENOSYS {
+		return unix.Kill(pid, sig)
+	}
+	return err
+}
+
+// isCgroupMember returns true if the cgroup v2 path of the process pid
+// is cgroupDir or a sub cgroup of cgroupDir.
+func isCgroupMember(pid int, cgroupDir string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return false, err
+	}
+	return cgroupContains(data, cgroupDir), nil
+}
+
+func cgroupContains(procCgroup []byte, cgroupDir string) bool {
+	dir := "/" + strings.Trim(cgroupDir, "/")
+	for _, line := range strings.Split(string(procCgroup), "\n") {
+		// e.g 0::/user.slice/user-0.slice/session-52.scope
+		if !strings.HasPrefix(line, "0::") {
+			continue
+		}
+		if dir == "/" {
+			return true
+		}
+		p := strings.TrimPrefix(line, "0::")
+		// The cgroup root of an unprivileged runtime is a sub cgroup
+		// of the cgroup2 mount, so a path suffix match is required.
+		return strings.HasSuffix(p, dir) || strings.Contains(p, dir+"/")
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseProcessStartTime(t *testing.T) {
+	// The command name may contain spaces and parentheses.
+	stat := []byte("4711 (a) b (c)) S 1 4711 4711 0 -1 4194560 239 0 0 0 0 0 0 0 20 0 1 0 123456 8192 190 18446744073709551615\n")
+	st, err := parseProcessStartTime(stat)
+	require.NoError(t, err)
+	require.Equal(t, uint64(123456), st)
+
+	_, err = parseProcessStartTime([]byte("4711 (a) S 1 4711"))
+	require.Error(t, err)
+
+	_, err = parseProcessStartTime([]byte("4711 a S"))
+	require.Error(t, err)
+}
+
+func TestProcessStartTime(t *testing.T) {
+	st, err := processStartTime(os.Getpid())
+	require.NoError(t, err)
+	require.NotZero(t, st)
+
+	require.NoError(t, checkProcessStartTime(os.Getpid(), st))
+	require.NoError(t, checkProcessStartTime(os.Getpid(), 0))
+
+	err = checkProcessStartTime(os.Getpid(), st+1)
+	require.True(t, errors.Is(err, ErrStalePid), "%s", err)
+
+	_, err = processStartTime(1 << 30)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestWaitProcessExitStalePid(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	st, err := processStartTime(cmd.Process.Pid)
+	require.NoError(t, err)
+
+	// A running process with a different start time is not the tracked process.
+	err = waitProcessExit(context.Background(), cmd.Process.Pid, st+1, func() bool { return true })
+	require.NoError(t, err)
+}
+
+func TestCgroupContains(t *testing.T) {
+	procCgroup := []byte("0::/lxcri.slice/lxcri-test.scope/ctr\n")
+	require.True(t, cgroupContains(procCgroup, "lxcri.slice/lxcri-test.scope"))
+	require.True(t, cgroupContains(procCgroup, "/lxcri-test.scope/ctr"))
+	require.False(t, cgroupContains(procCgroup, "lxcri.slice/lxcri-test"))
+	require.False(t, cgroupContains(procCgroup, "other.slice"))
+	require.True(t, cgroupContains(procCgroup, ""))
+
+	// cgroup v1 hierarchies are ignored
+	require.False(t, cgroupContains([]byte("1:name=systemd:/lxcri.slice\n"), "lxcri.slice"))
+}
+
+func TestSignalCgroupProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	pid := cmd.Process.Pid
+
+	err := signalCgroupProcess(pid, "/lxcri-not-a-member", unix.SIGKILL)
+	require.True(t, errors.Is(err, ErrStalePid), "%s", err)
+
+	data, err := os.ReadFile("/proc/self/cgroup")
+	require.NoError(t, err)
+	var dir string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			dir = strings.TrimPrefix(line, "0::")
+		}
+	}
+	if dir == "" || dir == "/" {
+		t.Skip("cgroup2 is not available")
+	}
+	require.NoError(t, signalCgroupProcess(pid, dir, unix.SIGKILL))
+	err = cmd.Wait()
+	require.Error(t, err)
+	require.Equal(t, unix.SIGKILL, cmd.ProcessState.Sys().(unix.WaitStatus).Signal())
+}
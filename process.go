@@ -0,0 +1,100 @@
+package lxcri
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Process is a process running within the container cgroup.
+type Process struct {
+	// PID is the process ID in the runtime PID namespace.
+	PID int `json:"pid"`
+	// NSpid are the process IDs in all PID namespaces the process is a member of,
+	// from the runtime PID namespace to the container PID namespace.
+	// The last element is the process ID within the container.
+	NSpid []int `json:"nspid,omitempty"`
+	// Command is the command line of the process,
+	// or the process name in square brackets if the command line is empty.
+	Command string `json:"cmd"`
+}
+
+// ContainerPID returns the process ID within the container PID namespace.
+func (p Process) ContainerPID() int {
+	if len(p.NSpid) == 0 {
+		return p.PID
+	}
+	return p.NSpid[len(p.NSpid)-1]
+}
+
+// Processes returns the processes within the container cgroup
+// excluding the liblxc monitor process.
+// Processes that exit while the process list is read are skipped.
+func (c *Container) Processes() ([]Process, error) {
+	if c.CgroupDir == "" {
+		return nil, errorf("container cgroup is undefined")
+	}
+	pids, err := readCgroupProcs(c.Log, filepath.Join(cgroupRoot, c.CgroupDir))
+	if err != nil {
+		return nil, errorf("failed to read cgroup procs: %w", err)
+	}
+	procs := make([]Process, 0, len(pids))
+	for _, pid := range pids {
+		if pid == c.Pid {
+			continue
+		}
+		p, err := readProcess("/proc", pid)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errorf("failed to read process %d: %w", pid, err)
+		}
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+func readProcess(procDir string, pid int) (Process, error) {
+	p := Process{PID: pid}
+	dir := filepath.Join(procDir, strconv.Itoa(pid))
+
+	status, err := os.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return p, err
+	}
+	var name string
+	for _, line := range strings.Split(string(status), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "Name:":
+			name = fields[1]
+		case "NSpid:":
+			for _, s := range fields[1:] {
+				nspid, err := strconv.Atoi(s)
+				if err != nil {
+					return p, fmt.Errorf("invalid NSpid %q: %w", line, err)
+				}
+				p.NSpid = append(p.NSpid, nspid)
+			}
+		}
+	}
+
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return p, err
+	}
+	// cmdline arguments are null terminated
+	args := bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0})
+	p.Command = string(bytes.Join(args, []byte(" ")))
+	if p.Command == "" {
+		p.Command = "[" + name + "]"
+	}
+	return p, nil
+}
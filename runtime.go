@@ -202,6 +202,8 @@ func (rt *Runtime) keepEnv(names ...string) {
 // The container must have been created with Runtime.Create.
 // The logger Container.Log is set to Runtime.Log by default.
 // A loaded Container must be released with Container.Release after use.
+// Load does not lock the container. Use Runtime.Lock to serialize
+// concurrent operations on the same container.
 func (rt *Runtime) Load(containerID string) (*Container, error) {
 	dir := filepath.Join(rt.Root, containerID)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -223,6 +225,7 @@ func (rt *Runtime) Load(containerID string) (*Container, error) {
 // Start simply unblocks the init process `lxcri-init`,
 // which then executes the container process.
 // The given container must have been created with Runtime.Create.
+// The caller should hold the container lock in LockExclusive mode (see Runtime.Lock).
 func (rt *Runtime) Start(ctx context.Context, c *Container) error {
 	rt.Log.Info().Msg("notify init to start container process")
 
@@ -286,6 +289,12 @@ func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
 
 	c.CreatedAt = time.Now()
 	c.Pid = cmd.Process.Pid
+	// The monitor PID can not be reused before the monitor is reaped
+	// by this process, so the start time belongs to the monitor.
+	c.PidStartTime, err = processStartTime(c.Pid)
+	if err != nil {
+		return fmt.Errorf("failed to get monitor process start time: %w", err)
+	}
 	rt.Log.Info().Int("pid", cmd.Process.Pid).Msg("monitor process started")
 
 	p := c.RuntimePath("lxcri.json")
@@ -306,35 +315,55 @@ func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
 }
 
 func runStartCmdConsole(ctx context.Context, cmd *exec.Cmd, consoleSocket string) error {
+	conn, err := dialConsoleSocket(ctx, consoleSocket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to start with pty: %w", err)
+	}
+	if err := sendConsole(conn, ptmx); err != nil {
+		ptmx.Close()
+		return err
+	}
+	return ptmx.Close()
+}
+
+func dialConsoleSocket(ctx context.Context, consoleSocket string) (*net.UnixConn, error) {
 	dialer := net.Dialer{}
 	c, err := dialer.DialContext(ctx, "unix", consoleSocket)
 	if err != nil {
-		return fmt.Errorf("connecting to console socket failed: %w", err)
+		return nil, fmt.Errorf("connecting to console socket failed: %w", err)
 	}
-	defer c.Close()
 
 	conn, ok := c.(*net.UnixConn)
 	if !ok {
-		return fmt.Errorf("expected a unix connection but was %T", conn)
+		c.Close()
+		return nil, fmt.Errorf("expected a unix connection but was %T", c)
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
 		err = conn.SetDeadline(deadline)
 		if err != nil {
-			return fmt.Errorf("failed to set connection deadline: %w", err)
+			conn.Close()
+			return nil, fmt.Errorf("failed to set connection deadline: %w", err)
 		}
 	}
+	return conn, nil
+}
 
+// sendConsole sends the pty master file descriptor ptmx over the
+// console socket connection conn (to the 'conmon' process).
+func sendConsole(conn *net.UnixConn, ptmx *os.File) error {
 	sockFile, err := conn.File()
 	if err != nil {
 		return fmt.Errorf("failed to get file from unix connection: %w", err)
 	}
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		return fmt.Errorf("failed to start with pty: %w", err)
-	}
+	defer sockFile.Close()
 
-	// Send the pty file descriptor over the console socket (to the 'conmon' process)
 	// For technical backgrounds see:
 	// * `man sendmsg 2`, `man unix 3`, `man cmsg 1`
 	// * https://blog.cloudflare.com/know-your-scm_rights/
@@ -344,11 +373,23 @@ func runStartCmdConsole(ctx context.Context, cmd *exec.Cmd, consoleSocket string
 	if err != nil {
 		return fmt.Errorf("failed to send console fd: %w", err)
 	}
-	return ptmx.Close()
+	return nil
 }
 
 // Kill sends the signal signum to the container init process.
 func (rt *Runtime) Kill(ctx context.Context, c *Container, signum unix.Signal) error {
+	state, err := c.ContainerState()
+	if err != nil {
+		return err
+	}
+	if state == specs.StateStopped {
+		return errorf("container already stopped")
+	}
+	return c.killInit(signum)
+}
+
+// KillAll sends the signal signum to all processes of the container.
+func (rt *Runtime) KillAll(ctx context.Context, c *Container, signum unix.Signal) error {
 	state, err := c.ContainerState()
 	if err != nil {
 		return err
@@ -359,12 +400,178 @@ func (rt *Runtime) Kill(ctx context.Context, c *Container, signum unix.Signal) e
 	return c.kill(ctx, signum)
 }
 
+// StopSignalAnnotation is the image annotation that contains the
+// signal to stop the container process (see Runtime.Stop).
+const StopSignalAnnotation = "org.opencontainers.image.stopSignal"
+
+// Stop stops the container gracefully.
+// The stop signal is sent to the container init process.
+// The stop signal is unix.SIGTERM unless it is set by the StopSignalAnnotation.
+// An invalid StopSignalAnnotation value is logged and unix.SIGTERM is used instead.
+// If the container cgroup is still populated after the given timeout,
+// all container processes are killed with unix.SIGKILL.
+// Stop returns when the container process and the monitor process have exited.
+// Stop returns immediately if the container is already stopped.
+func (rt *Runtime) Stop(ctx context.Context, c *Container, timeout time.Duration) error {
+	sig := unix.SIGTERM
+	if val, ok := c.Spec.Annotations[StopSignalAnnotation]; ok {
+		sig = ParseSignal(val)
+		if sig == 0 {
+			c.Log.Warn().Msgf("invalid stop signal %q - using SIGTERM", val)
+			sig = unix.SIGTERM
+		}
+	}
+
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state == specs.StateStopped {
+		return nil
+	}
+
+	c.Log.Info().Stringer("signal", sig).Dur("timeout", timeout).Msg("stopping container")
+	if err := c.killInit(sig); err != nil {
+		return errorf("failed to send stop signal: %w", err)
+	}
+	// The processes of a paused container can not exit
+	// until the container cgroup is thawed.
+	if state == StatePaused {
+		if err := freezeCgroup(ctx, c, false); err != nil {
+			return errorf("failed to thaw container: %w", err)
+		}
+	}
+
+	graceCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err = c.waitCgroupEmpty(graceCtx)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		c.Log.Info().Msg("stop timeout exceeded - killing container")
+		if err := c.kill(ctx, unix.SIGKILL); err != nil {
+			return errorf("failed to kill container: %w", err)
+		}
+		err = c.waitCgroupEmpty(ctx)
+	}
+	if err != nil {
+		return errorf("failed to wait for container processes to exit: %w", err)
+	}
+
+	if err := c.waitMonitorStopped(ctx); err != nil {
+		return errorf("failed to wait for monitor process to exit: %w", err)
+	}
+	return nil
+}
+
+// Wait waits until the container process has exited and returns the exit status.
+// Wait returns immediately if the container is already stopped.
+func (rt *Runtime) Wait(ctx context.Context, c *Container) (*ExitStatus, error) {
+	if err := c.waitMonitorStopped(ctx); err != nil {
+		return nil, errorf("failed to wait for container process: %w", err)
+	}
+	status, err := c.ExitStatus()
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return nil, errorf("exit status is not available: monitor process %d has died", c.Pid)
+	}
+	return status, nil
+}
+
+// Pause freezes all processes of the given container.
+// The container must be either in state specs.StateCreated or specs.StateRunning.
+// A paused container is in state StatePaused until it is resumed.
+func (rt *Runtime) Pause(ctx context.Context, c *Container) error {
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != specs.StateCreated && state != specs.StateRunning {
+		return errorf("can not pause container with state %q", state)
+	}
+	c.Log.Info().Msg("pausing container")
+	return freezeCgroup(ctx, c, true)
+}
+
+// Resume thaws all processes of the given paused container.
+// The container must be in state StatePaused.
+func (rt *Runtime) Resume(ctx context.Context, c *Container) error {
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != StatePaused {
+		return errorf("invalid container state. expected %q, but was %q", StatePaused, state)
+	}
+	c.Log.Info().Msg("resuming container")
+	return freezeCgroup(ctx, c, false)
+}
+
+// Update changes the cgroup resource limits of the given container.
+// Only the resources that are set in the given resources are changed.
+// The values are written to the container cgroup and the
+// updated resources are persisted in the container runtime directory.
+func (rt *Runtime) Update(ctx context.Context, c *Container, resources *specs.LinuxResources) error {
+	if resources == nil {
+		return errorf("resources are nil")
+	}
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state == specs.StateStopped {
+		return errorf("can not update resources of stopped container")
+	}
+	if len(resources.Devices) > 0 {
+		return errorf("updating cgroup device rules is not supported")
+	}
+	if resources.Network != nil || len(resources.Rdma) > 0 {
+		return errorf("updating network or rdma resources is not supported")
+	}
+
+	merged, changed := mergeResources(c.Spec.Linux.Resources, resources)
+	vals, err := resourceValues(changed)
+	if err != nil {
+		return err
+	}
+	if err := checkCgroupResources(c, changed, vals); err != nil {
+		return err
+	}
+
+	c.Log.Info().Interface("values", vals).Msg("update cgroup resources")
+	if err := writeCgroupValues(filepath.Join(cgroupRoot, c.CgroupDir), vals); err != nil {
+		return errorf("failed to update cgroup: %w", err)
+	}
+
+	c.Spec.Linux.Resources = merged
+	return c.save()
+}
+
 // Delete removes the container from the runtime directory.
 // The container must be stopped or force must be set to true.
 // If the container is not stopped but force is set to true,
 // the container will be killed with unix.SIGKILL.
+// Processes of exec sessions that are still running are killed
+// and the exec sessions are removed along with the runtime directory.
+// The container is locked in LockExclusive mode until Delete returns.
 func (rt *Runtime) Delete(ctx context.Context, containerID string, force bool) error {
 	rt.Log.Info().Bool("force", force).Msg("delete container")
+	lock, err := rt.Lock(ctx, containerID, LockExclusive)
+	if err != nil {
+		return err
+	}
+	err = rt.delete(ctx, containerID, force)
+	if err == nil || err == ErrNotExist {
+		if err := lock.remove(); err != nil {
+			rt.Log.Warn().Msgf("failed to remove lock file: %s", err)
+		}
+		return err
+	}
+	lock.Unlock()
+	return err
+}
+
+func (rt *Runtime) delete(ctx context.Context, containerID string, force bool) error {
 	c, err := rt.Load(containerID)
 	if err == ErrNotExist {
 		return err
@@ -389,8 +596,19 @@ func (rt *Runtime) Delete(ctx context.Context, containerID string, force bool) e
 		if err := c.kill(ctx, unix.SIGKILL); err != nil {
 			return errorf("failed to kill container: %w", err)
 		}
+		// The killed processes of a paused container can not exit
+		// until the container cgroup is thawed.
+		if state == StatePaused {
+			if err := freezeCgroup(ctx, c, false); err != nil {
+				return errorf("failed to thaw container: %w", err)
+			}
+		}
 	}
 
+	// Exec processes that are not attached to the container
+	// PID namespace are not killed when the container init exits.
+	c.killExecSessions()
+
 	if err := c.waitMonitorStopped(ctx); err != nil {
 		c.Log.Error().Msgf("failed to stop monitor process %d", c.Pid)
 	}
@@ -405,11 +623,8 @@ func (rt *Runtime) Delete(ctx context.Context, containerID string, force bool) e
 	}
 
 	// the monitor might be part of the cgroup so wait for it to exit
-	eventsFile := filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.events")
-	err = pollCgroupEvents(ctx, eventsFile, func(ev cgroupEvents) bool {
-		return !ev.populated
-	})
-	if err != nil && !os.IsNotExist(err) {
+	err = c.waitCgroupEmpty(ctx)
+	if err != nil {
 		// try to delete the cgroup anyways
 		c.Log.Warn().Msgf("failed to wait until cgroup.events populated=0: %s", err)
 	}
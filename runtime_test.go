@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/lxc/lxcri/pkg/log"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sys/unix"
 )
@@ -38,12 +40,12 @@ func mkdirTemp() (string, error) {
 	return os.MkdirTemp(tmpRoot, "lxcri-test")
 }
 
-func removeAll(t *testing.T, filename string) {
+func removeAll(t testing.TB, filename string) {
 	err := os.RemoveAll(filename)
 	require.NoError(t, err)
 }
 
-func newRuntime(t *testing.T) *Runtime {
+func newRuntime(t testing.TB) *Runtime {
 	runtimeRoot, err := mkdirTemp()
 	require.NoError(t, err)
 	t.Logf("runtime root: %s", runtimeRoot)
@@ -68,7 +70,7 @@ func newRuntime(t *testing.T) *Runtime {
 // NOTE a container that was created successfully must always be
 // deleted, otherwise the go test runner will hang because it waits
 // for the container process to exit.
-func newConfig(t *testing.T, cmd string, args ...string) *ContainerConfig {
+func newConfig(t testing.TB, cmd string, args ...string) *ContainerConfig {
 	rootfs, err := mkdirTemp()
 	require.NoError(t, err)
 	t.Logf("container rootfs: %s", rootfs)
@@ -317,10 +319,40 @@ func testRuntime(t *testing.T, rt *Runtime, cfg *ContainerConfig) {
 	err = rt.Kill(ctx, c, unix.SIGUSR1)
 	require.NoError(t, err)
 
+	err = rt.KillAll(ctx, c, unix.SIGUSR1)
+	require.NoError(t, err)
+
+	state, err = c.State()
+	require.NoError(t, err)
+	require.Equal(t, specs.StateRunning, state.SpecState.Status)
+
+	err = rt.Pause(ctx, c)
+	require.NoError(t, err)
+
+	state, err = c.State()
+	require.NoError(t, err)
+	require.Equal(t, StatePaused, state.SpecState.Status)
+
+	err = rt.Resume(ctx, c)
+	require.NoError(t, err)
+
 	state, err = c.State()
 	require.NoError(t, err)
 	require.Equal(t, specs.StateRunning, state.SpecState.Status)
 
+	err = rt.Kill(ctx, c, unix.SIGKILL)
+	require.NoError(t, err)
+
+	status, err := rt.Wait(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, 137, status.ExitCode)
+	require.Equal(t, ExitReasonSignaled, status.Reason)
+
+	state, err = c.State()
+	require.NoError(t, err)
+	require.Equal(t, specs.StateStopped, state.SpecState.Status)
+	require.Equal(t, status, state.ExitStatus)
+
 	err = rt.Delete(ctx, c.ContainerID, true)
 	require.NoError(t, err)
 
@@ -331,3 +363,165 @@ func testRuntime(t *testing.T, rt *Runtime, cfg *ContainerConfig) {
 	err = c.Release()
 	require.NoError(t, err)
 }
+
+func TestRuntimeStop(t *testing.T) {
+	t.Parallel()
+	if os.Getuid() != 0 {
+		t.Skipf("This tests only runs as root")
+	}
+
+	rt := newRuntime(t)
+	defer removeAll(t, rt.Root)
+
+	stop := func(cfg *ContainerConfig, timeout time.Duration) *ExitStatus {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		c, err := rt.Create(ctx, cfg)
+		require.NoError(t, err)
+		defer c.Release()
+		require.NoError(t, rt.Start(ctx, c))
+
+		require.NoError(t, rt.Stop(ctx, c, timeout))
+
+		state, err := c.ContainerState()
+		require.NoError(t, err)
+		require.Equal(t, specs.StateStopped, state)
+
+		status, err := c.ExitStatus()
+		require.NoError(t, err)
+		require.NotNil(t, status)
+
+		require.NoError(t, rt.Delete(ctx, c.ContainerID, false))
+		return status
+	}
+
+	// lxcri-test ignores SIGTERM and is killed after the timeout
+	cfg := newConfig(t, "lxcri-test")
+	defer removeAll(t, cfg.Spec.Root.Path)
+	status := stop(cfg, time.Millisecond*200)
+	require.Equal(t, unix.SIGKILL, status.Signal)
+
+	// stop signal from image annotation
+	cfg = newConfig(t, "lxcri-test")
+	defer removeAll(t, cfg.Spec.Root.Path)
+	cfg.Spec.Annotations = map[string]string{StopSignalAnnotation: "SIGHUP"}
+	status = stop(cfg, time.Second*5)
+	require.Equal(t, unix.SIGHUP, status.Signal)
+}
+
+// TestRuntimeParallelLifecycle runs container operations in parallel
+// to a forced delete. Every operation must either succeed or fail
+// with ErrNotExist after the container was deleted.
+func TestRuntimeParallelLifecycle(t *testing.T) {
+	t.Parallel()
+	if os.Getuid() != 0 {
+		t.Skipf("This tests only runs as root")
+	}
+
+	rt := newRuntime(t)
+	defer removeAll(t, rt.Root)
+
+	cfg := newConfig(t, "lxcri-test")
+	defer removeAll(t, cfg.Spec.Root.Path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c, err := rt.Create(ctx, cfg)
+	require.NoError(t, err)
+	require.NoError(t, rt.Start(ctx, c))
+	require.NoError(t, c.Release())
+
+	op := func(mode LockMode, fn func(c *Container) error) error {
+		lock, err := rt.Lock(ctx, cfg.ContainerID, mode)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+		c, err := rt.Load(cfg.ContainerID)
+		if err != nil {
+			return err
+		}
+		defer c.Release()
+		return fn(c)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				var err error
+				switch (i + j) % 3 {
+				case 0:
+					err = op(LockShared, func(c *Container) error {
+						_, err := c.State()
+						return err
+					})
+				case 1:
+					err = op(LockShared, func(c *Container) error {
+						state, err := c.ContainerState()
+						if err != nil || state == specs.StateStopped {
+							return err
+						}
+						return rt.Kill(ctx, c, unix.SIGUSR1)
+					})
+				case 2:
+					err = op(LockExclusive, func(c *Container) error {
+						_, err := c.Stats()
+						return err
+					})
+				}
+				if err != nil && err != ErrNotExist {
+					t.Errorf("operation failed: %s", err)
+				}
+			}
+		}(i)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	require.NoError(t, rt.Delete(ctx, cfg.ContainerID, true))
+	wg.Wait()
+
+	_, err = rt.Load(cfg.ContainerID)
+	require.Equal(t, ErrNotExist, err)
+}
+
+// BenchmarkCreateDelete measures the latency of create, start and delete
+// with the event driven wait functions and the sleep polling fallback.
+func BenchmarkCreateDelete(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		polling bool
+	}{{"event", false}, {"polling", true}} {
+		b.Run(bm.name, func(b *testing.B) {
+			withWaitPolling(bm.polling, func() {
+				rt := newRuntime(b)
+				defer removeAll(b, rt.Root)
+				rt.Log = rt.Log.Level(zerolog.WarnLevel)
+
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					cfg := newConfig(b, "lxcri-test")
+					cfg.Log = cfg.Log.Level(zerolog.WarnLevel)
+					cfg.LogLevel = "warn"
+					b.StartTimer()
+
+					ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+					c, err := rt.Create(ctx, cfg)
+					require.NoError(b, err)
+					require.NoError(b, rt.Start(ctx, c))
+					require.NoError(b, rt.Delete(ctx, c.ContainerID, true))
+					require.NoError(b, c.Release())
+					cancel()
+
+					b.StopTimer()
+					removeAll(b, cfg.Spec.Root.Path)
+					b.StartTimer()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"golang.org/x/sys/unix"
+)
+
+// execSessionDir is the directory within the container runtime directory
+// that contains the exec session files.
+const execSessionDir = "exec"
+
+// ErrExecSessionNotExist is returned if an exec session does not exist.
+var ErrExecSessionNotExist = fmt.Errorf("exec session does not exist")
+
+// ExecSession is the record of a process executed within the container
+// (see ExecOptions.SessionID).
+// The sessions are removed along with the container runtime directory
+// when the container is deleted.
+type ExecSession struct {
+	ID string `json:"id"`
+	// Pid is the process ID of the exec process.
+	// It is 0 until the process is started.
+	Pid int `json:"pid"`
+	// PidStartTime is the start time of the process
+	// in clock ticks after system boot (see processStartTime).
+	PidStartTime uint64    `json:"pidStartTime"`
+	Args         []string  `json:"args"`
+	CreatedAt    time.Time `json:"createdAt"`
+	// ExitStatus is the exit status of the process.
+	// It is only recorded if the process was awaited with ExecProcess.Wait.
+	// It is never recorded for a process that was released with ExecProcess.Release
+	// (e.g by Container.ExecDetached or `lxcri exec --detach`), because the runtime
+	// does not wait for it. The status of such a session is unknown after the process exited.
+	ExitStatus *int `json:"exitStatus,omitempty"`
+	// FinishedAt is the time the exit status was recorded.
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Running returns true if the process of the session is running.
+func (s *ExecSession) Running() bool {
+	if s.Pid == 0 || s.ExitStatus != nil {
+		return false
+	}
+	st, err := processStartTime(s.Pid)
+	return err == nil && st == s.PidStartTime
+}
+
+func (c *Container) execSessionPath(id string) string {
+	return c.RuntimePath(execSessionDir, id+".json")
+}
+
+// createExecSession creates the session file for the given session.
+// It fails if a session with the same ID already exists.
+func (c *Container) createExecSession(s *ExecSession) error {
+	if s.ID == "" || strings.ContainsRune(s.ID, '/') || s.ID[0] == '.' {
+		return fmt.Errorf("invalid exec session ID %q", s.ID)
+	}
+	if err := os.MkdirAll(c.RuntimePath(execSessionDir), 0700); err != nil {
+		return err
+	}
+	err := c.writeExecSession(s, true)
+	if os.IsExist(err) {
+		return fmt.Errorf("exec session %q already exists", s.ID)
+	}
+	return err
+}
+
+// writeExecSession atomically writes the session file.
+// If create is true, it fails if the session file already exists.
+func (c *Container) writeExecSession(s *ExecSession, create bool) error {
+	tmp, err := os.CreateTemp(c.RuntimePath(execSessionDir), "."+s.ID)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(s); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if create {
+		// link fails if the session file already exists
+		return os.Link(tmp.Name(), c.execSessionPath(s.ID))
+	}
+	return os.Rename(tmp.Name(), c.execSessionPath(s.ID))
+}
+
+// ExecSession returns the exec session with the given ID.
+// ErrExecSessionNotExist is returned if the session does not exist.
+func (c *Container) ExecSession(id string) (*ExecSession, error) {
+	if id == "" || strings.ContainsRune(id, '/') || id[0] == '.' {
+		return nil, errorf("invalid exec session ID %q", id)
+	}
+	s := new(ExecSession)
+	err := specki.DecodeJSONFile(c.execSessionPath(id), s)
+	if os.IsNotExist(err) {
+		return nil, ErrExecSessionNotExist
+	}
+	if err != nil {
+		return nil, errorf("failed to load exec session %q: %w", id, err)
+	}
+	return s, nil
+}
+
+// ExecSessions returns all exec sessions of the container
+// ordered by creation time.
+func (c *Container) ExecSessions() ([]*ExecSession, error) {
+	names, err := readDirNames(c.RuntimePath(execSessionDir))
+	if err != nil {
+		return nil, errorf("failed to list exec sessions: %w", err)
+	}
+	sessions := make([]*ExecSession, 0, len(names))
+	for _, name := range names {
+		// ignore temporary files
+		if name[0] == '.' || filepath.Ext(name) != ".json" {
+			continue
+		}
+		s, err := c.ExecSession(strings.TrimSuffix(name, ".json"))
+		// The session file might have been removed in the meantime.
+		if err == ErrExecSessionNotExist {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// SignalExec sends the signal sig to the process of the exec session
+// with the given ID.
+func (c *Container) SignalExec(id string, sig unix.Signal) error {
+	s, err := c.ExecSession(id)
+	if err != nil {
+		return err
+	}
+	if s.Pid == 0 {
+		return errorf("exec session %q was not started", id)
+	}
+	if s.ExitStatus != nil {
+		return errorf("exec session %q has exited", id)
+	}
+
+	fd, err := openPidfd(s.Pid, s.PidStartTime)
+	if err == unix.ENOSYS {
+		err = checkProcessStartTime(s.Pid, s.PidStartTime)
+		if err == nil {
+			err = unix.Kill(s.Pid, sig)
+		}
+	} else if err == nil {
+		err = pidfdSendSignal(fd, sig)
+		unix.Close(fd)
+	}
+	if err == unix.ESRCH || os.IsNotExist(err) || errors.Is(err, ErrStalePid) {
+		return errorf("exec session %q has exited", id)
+	}
+	if err != nil {
+		return errorf("failed to signal exec session %q: %w", id, err)
+	}
+	return nil
+}
+
+// killExecSessions kills the processes of all running exec sessions.
+func (c *Container) killExecSessions() {
+	sessions, err := c.ExecSessions()
+	if err != nil {
+		c.Log.Warn().Msgf("failed to list exec sessions: %s", err)
+		return
+	}
+	for _, s := range sessions {
+		if !s.Running() {
+			continue
+		}
+		if err := c.SignalExec(s.ID, unix.SIGKILL); err != nil {
+			c.Log.Warn().Msgf("failed to kill exec session process: %s", err)
+		}
+	}
+}
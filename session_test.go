@@ -0,0 +1,64 @@
+package lxcri
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestExecSessions(t *testing.T) {
+	c := &Container{
+		ContainerConfig: &ContainerConfig{Log: zerolog.Nop()},
+		runtimeDir:      t.TempDir(),
+	}
+
+	sessions, err := c.ExecSessions()
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	_, err = c.ExecSession("s1")
+	require.Equal(t, ErrExecSessionNotExist, err)
+
+	cmd := exec.Command("/bin/sleep", "10")
+	require.NoError(t, cmd.Start())
+	startTime, err := processStartTime(cmd.Process.Pid)
+	require.NoError(t, err)
+
+	now := time.Now()
+	s1 := &ExecSession{ID: "s1", Args: cmd.Args, CreatedAt: now}
+	require.NoError(t, c.createExecSession(s1))
+	require.Error(t, c.createExecSession(&ExecSession{ID: "s1"}))
+	for _, id := range []string{"", ".s2", "s2/x"} {
+		require.Error(t, c.createExecSession(&ExecSession{ID: id}), "id:%q", id)
+	}
+
+	s1.Pid = cmd.Process.Pid
+	s1.PidStartTime = startTime
+	require.NoError(t, c.writeExecSession(s1, false))
+
+	exitStatus := 1
+	s0 := &ExecSession{ID: "s0", Pid: 1, Args: []string{"true"}, CreatedAt: now.Add(-time.Second), ExitStatus: &exitStatus}
+	require.NoError(t, c.createExecSession(s0))
+
+	sessions, err = c.ExecSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, "s0", sessions[0].ID)
+	require.False(t, sessions[0].Running())
+	require.Equal(t, "s1", sessions[1].ID)
+	require.Equal(t, cmd.Process.Pid, sessions[1].Pid)
+	require.True(t, sessions[1].Running())
+
+	require.Error(t, c.SignalExec("s0", unix.SIGKILL))
+	require.NoError(t, c.SignalExec("s1", unix.SIGKILL))
+	require.Error(t, cmd.Wait())
+
+	s, err := c.ExecSession("s1")
+	require.NoError(t, err)
+	require.False(t, s.Running())
+	require.Error(t, c.SignalExec("s1", unix.SIGKILL))
+}
@@ -0,0 +1,349 @@
+package lxcri
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Stats are the cgroup v2 accounting values of a container.
+// The JSON encoding is compatible with the stats data
+// emitted by runc `events --stats`.
+type Stats struct {
+	CPU    CPUStats    `json:"cpu"`
+	Memory MemoryStats `json:"memory"`
+	Pids   PidsStats   `json:"pids"`
+	Blkio  BlkioStats  `json:"blkio"`
+}
+
+// CPUStats are the values from the cpu controller.
+type CPUStats struct {
+	Usage      CPUUsage   `json:"usage,omitempty"`
+	Throttling Throttling `json:"throttling,omitempty"`
+	PSI        *PSIStats  `json:"psi,omitempty"`
+}
+
+// CPUUsage is the CPU time consumed by the container in nanoseconds.
+type CPUUsage struct {
+	Kernel uint64 `json:"kernel"`
+	User   uint64 `json:"user"`
+	Total  uint64 `json:"total,omitempty"`
+}
+
+// Throttling are the CPU bandwidth throttling statistics.
+// ThrottledTime is in nanoseconds.
+type Throttling struct {
+	Periods          uint64 `json:"periods,omitempty"`
+	ThrottledPeriods uint64 `json:"throttledPeriods,omitempty"`
+	ThrottledTime    uint64 `json:"throttledTime,omitempty"`
+}
+
+// MemoryStats are the values from the memory controller.
+// Raw contains all values from memory.stat.
+type MemoryStats struct {
+	Cache uint64            `json:"cache,omitempty"`
+	Usage MemoryEntry       `json:"usage,omitempty"`
+	Swap  MemoryEntry       `json:"swap,omitempty"`
+	Raw   map[string]uint64 `json:"raw,omitempty"`
+	PSI   *PSIStats         `json:"psi,omitempty"`
+}
+
+// MemoryEntry is the usage and limit of a memory resource in bytes.
+// An unlimited resource has the Limit math.MaxUint64.
+// Failcnt is the number of times the usage hit the limit.
+type MemoryEntry struct {
+	Limit   uint64 `json:"limit"`
+	Usage   uint64 `json:"usage,omitempty"`
+	Max     uint64 `json:"max,omitempty"`
+	Failcnt uint64 `json:"failcnt"`
+}
+
+// PidsStats are the values from the pids controller.
+// An unlimited pids controller has the Limit 0.
+type PidsStats struct {
+	Current uint64 `json:"current,omitempty"`
+	Limit   uint64 `json:"limit,omitempty"`
+}
+
+// BlkioStats are the values from the io controller.
+type BlkioStats struct {
+	IoServiceBytesRecursive []BlkioEntry `json:"ioServiceBytesRecursive,omitempty"`
+	IoServicedRecursive     []BlkioEntry `json:"ioServicedRecursive,omitempty"`
+	PSI                     *PSIStats    `json:"psi,omitempty"`
+}
+
+// BlkioEntry is a single value for the block device Major:Minor.
+// Op is the IO operation, either Read, Write or Discard.
+type BlkioEntry struct {
+	Major uint64 `json:"major,omitempty"`
+	Minor uint64 `json:"minor,omitempty"`
+	Op    string `json:"op,omitempty"`
+	Value uint64 `json:"value,omitempty"`
+}
+
+// PSIStats are the pressure stall information from a *.pressure file.
+// See https://www.kernel.org/doc/html/latest/accounting/psi.html
+type PSIStats struct {
+	Some PSIData `json:"some,omitempty"`
+	Full PSIData `json:"full,omitempty"`
+}
+
+// PSIData are the pressure averages in percent
+// and the total stall time in microseconds.
+type PSIData struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// Stats returns the cgroup accounting values of the container.
+// Values of controllers that are not enabled for the container cgroup are zero.
+func (c *Container) Stats() (*Stats, error) {
+	if c.CgroupDir == "" {
+		return nil, errorf("container cgroup is undefined")
+	}
+	stats, err := readCgroupStats(filepath.Join(cgroupRoot, c.CgroupDir))
+	if err != nil {
+		return nil, errorf("failed to read cgroup stats: %w", err)
+	}
+	return stats, nil
+}
+
+func readCgroupStats(dir string) (*Stats, error) {
+	stats := new(Stats)
+
+	// values in cpu.stat are in microseconds
+	cpu, err := parseFlatKeyed(filepath.Join(dir, "cpu.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stats.CPU.Usage.Total = cpu["usage_usec"] * 1000
+	stats.CPU.Usage.User = cpu["user_usec"] * 1000
+	stats.CPU.Usage.Kernel = cpu["system_usec"] * 1000
+	stats.CPU.Throttling.Periods = cpu["nr_periods"]
+	stats.CPU.Throttling.ThrottledPeriods = cpu["nr_throttled"]
+	stats.CPU.Throttling.ThrottledTime = cpu["throttled_usec"] * 1000
+
+	if stats.CPU.PSI, err = parsePSI(filepath.Join(dir, "cpu.pressure")); err != nil {
+		return nil, err
+	}
+
+	if err := readMemoryStats(dir, &stats.Memory); err != nil {
+		return nil, err
+	}
+
+	if stats.Pids.Current, err = parseSingleValue(filepath.Join(dir, "pids.current")); err != nil {
+		return nil, err
+	}
+	if stats.Pids.Limit, err = parseSingleValue(filepath.Join(dir, "pids.max")); err != nil {
+		return nil, err
+	}
+	if stats.Pids.Limit == math.MaxUint64 {
+		stats.Pids.Limit = 0
+	}
+
+	if err := readIOStats(dir, &stats.Blkio); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func readMemoryStats(dir string, mem *MemoryStats) error {
+	var err error
+	if mem.Raw, err = parseFlatKeyed(filepath.Join(dir, "memory.stat")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	mem.Cache = mem.Raw["file"]
+
+	if mem.Usage.Usage, err = parseSingleValue(filepath.Join(dir, "memory.current")); err != nil {
+		return err
+	}
+	if mem.Usage.Limit, err = parseSingleValue(filepath.Join(dir, "memory.max")); err != nil {
+		return err
+	}
+	// memory.peak is available since linux 5.19
+	if mem.Usage.Max, err = parseSingleValue(filepath.Join(dir, "memory.peak")); err != nil {
+		return err
+	}
+
+	events, err := parseFlatKeyed(filepath.Join(dir, "memory.events"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	mem.Usage.Failcnt = events["max"]
+
+	// Swap values in runc include memory (cgroup v1 semantics).
+	swapUsage, err := parseSingleValue(filepath.Join(dir, "memory.swap.current"))
+	if err != nil {
+		return err
+	}
+	swapLimit, err := parseSingleValue(filepath.Join(dir, "memory.swap.max"))
+	if err != nil {
+		return err
+	}
+	mem.Swap.Usage = swapUsage + mem.Usage.Usage
+	mem.Swap.Limit = math.MaxUint64
+	if swapLimit != math.MaxUint64 && mem.Usage.Limit != math.MaxUint64 {
+		mem.Swap.Limit = swapLimit + mem.Usage.Limit
+	}
+
+	mem.PSI, err = parsePSI(filepath.Join(dir, "memory.pressure"))
+	return err
+}
+
+func readIOStats(dir string, blkio *BlkioStats) error {
+	f, err := os.Open(filepath.Join(dir, "io.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		defer f.Close()
+		// e.g 8:0 rbytes=90430464 wbytes=299008000 rios=8950 wios=1252 dbytes=50331648 dios=3021
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) < 2 {
+				continue
+			}
+			var major, minor uint64
+			if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+				return fmt.Errorf("invalid device %q in io.stat: %w", fields[0], err)
+			}
+			for _, kv := range fields[1:] {
+				vals := strings.SplitN(kv, "=", 2)
+				if len(vals) != 2 {
+					continue
+				}
+				v, err := strconv.ParseUint(vals[1], 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid value %q in io.stat: %w", kv, err)
+				}
+				entry := BlkioEntry{Major: major, Minor: minor, Value: v}
+				switch vals[0] {
+				case "rbytes":
+					entry.Op = "Read"
+					blkio.IoServiceBytesRecursive = append(blkio.IoServiceBytesRecursive, entry)
+				case "wbytes":
+					entry.Op = "Write"
+					blkio.IoServiceBytesRecursive = append(blkio.IoServiceBytesRecursive, entry)
+				case "dbytes":
+					entry.Op = "Discard"
+					blkio.IoServiceBytesRecursive = append(blkio.IoServiceBytesRecursive, entry)
+				case "rios":
+					entry.Op = "Read"
+					blkio.IoServicedRecursive = append(blkio.IoServicedRecursive, entry)
+				case "wios":
+					entry.Op = "Write"
+					blkio.IoServicedRecursive = append(blkio.IoServicedRecursive, entry)
+				case "dios":
+					entry.Op = "Discard"
+					blkio.IoServicedRecursive = append(blkio.IoServicedRecursive, entry)
+				}
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+
+	blkio.PSI, err = parsePSI(filepath.Join(dir, "io.pressure"))
+	return err
+}
+
+// parseSingleValue parses a cgroup interface file that contains a single value.
+// The value "max" is returned as math.MaxUint64.
+// A non-existing file is not an error and 0 is returned.
+func parseSingleValue(filename string) (uint64, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return math.MaxUint64, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s: %w", s, filename, err)
+	}
+	return v, nil
+}
+
+// parseFlatKeyed parses a cgroup interface file in
+// flat keyed format, e.g cpu.stat or memory.stat
+func parseFlatKeyed(filename string) (map[string]uint64, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	vals := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q in %s: %w", line, filename, err)
+		}
+		vals[fields[0]] = v
+	}
+	return vals, nil
+}
+
+// parsePSI parses a pressure stall information file.
+// nil is returned if the file does not exist (e.g CONFIG_PSI is disabled).
+// e.g some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePSI(filename string) (*PSIStats, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	psi := new(PSIStats)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var d *PSIData
+		switch fields[0] {
+		case "some":
+			d = &psi.Some
+		case "full":
+			d = &psi.Full
+		default:
+			continue
+		}
+		for _, kv := range fields[1:] {
+			vals := strings.SplitN(kv, "=", 2)
+			if len(vals) != 2 {
+				continue
+			}
+			switch vals[0] {
+			case "avg10":
+				d.Avg10, err = strconv.ParseFloat(vals[1], 64)
+			case "avg60":
+				d.Avg60, err = strconv.ParseFloat(vals[1], 64)
+			case "avg300":
+				d.Avg300, err = strconv.ParseFloat(vals[1], 64)
+			case "total":
+				d.Total, err = strconv.ParseUint(vals[1], 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q in %s: %w", kv, filename, err)
+			}
+		}
+	}
+	return psi, nil
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 
 	"golang.org/x/sys/unix"
 )
@@ -59,3 +61,73 @@ func errorf(sfmt string, args ...interface{}) error {
 	prefix := fmt.Sprintf("[%s:%s:%d] ", bin, filepath.Base(file), line)
 	return fmt.Errorf(prefix+sfmt, args...)
 }
+
+// ParseSignal parses the given signal name or number.
+// Signal names are case insensitive and the `SIG` prefix is optional
+// e.g 9, kill, sigkill, SIGKILL. An empty string is parsed as unix.SIGTERM.
+// Realtime signals are parsed relative to SIGRTMIN or SIGRTMAX e.g RTMIN+3, SIGRTMAX-1.
+// Zero is returned if the signal name is undefined or the signal number
+// is not within the range 1..SIGRTMAX.
+func ParseSignal(sig string) unix.Signal {
+	if sig == "" {
+		return unix.SIGTERM
+	}
+	// handle numerical signal value
+	if num, err := strconv.Atoi(sig); err == nil {
+		if num < 1 || num > sigRtMax {
+			return 0
+		}
+		return unix.Signal(num)
+	}
+
+	// gracefully handle all string variants e.g 'sigkill|SIGKILL|kill|KILL'
+	s := strings.ToUpper(sig)
+	if !strings.HasPrefix(s, "SIG") {
+		s = "SIG" + s
+	}
+	if strings.HasPrefix(s, "SIGRTM") {
+		return parseRealtimeSignal(s)
+	}
+	return unix.SignalNum(s)
+}
+
+// Realtime signal range as seen by applications.
+// glibc reserves the first two realtime signals for internal use.
+const (
+	sigRtMin = 34
+	sigRtMax = 64
+)
+
+// parseRealtimeSignal parses SIGRTMIN+n and SIGRTMAX-n.
+// Zero is returned if the name is invalid or the signal is out of range.
+func parseRealtimeSignal(s string) unix.Signal {
+	var sig int
+	var op byte
+	switch {
+	case strings.HasPrefix(s, "SIGRTMIN"):
+		sig, op, s = sigRtMin, '+', s[len("SIGRTMIN"):]
+	case strings.HasPrefix(s, "SIGRTMAX"):
+		sig, op, s = sigRtMax, '-', s[len("SIGRTMAX"):]
+	default:
+		return 0
+	}
+	if s == "" {
+		return unix.Signal(sig)
+	}
+	if s[0] != op {
+		return 0
+	}
+	n, err := strconv.Atoi(s[1:])
+	if err != nil || n < 0 || n > sigRtMax-sigRtMin {
+		return 0
+	}
+	if op == '+' {
+		return unix.Signal(sig + n)
+	}
+	return unix.Signal(sig - n)
+}
+
+// shellQuote quotes s as a single word for the POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,69 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseSignal(t *testing.T) {
+	sig := ParseSignal("9")
+	require.Equal(t, unix.SIGKILL, sig)
+
+	sig = ParseSignal("kill")
+	require.Equal(t, unix.SIGKILL, sig)
+
+	sig = ParseSignal("sigkill")
+	require.Equal(t, unix.SIGKILL, sig)
+
+	sig = ParseSignal("KILL")
+	require.Equal(t, unix.SIGKILL, sig)
+
+	sig = ParseSignal("SIGKILL")
+	require.Equal(t, unix.SIGKILL, sig)
+
+	sig = ParseSignal("SIGNOTEXIST")
+	require.Equal(t, unix.Signal(0), sig)
+
+	sig = ParseSignal("64")
+	require.Equal(t, unix.Signal(64), sig)
+
+	sig = ParseSignal("999")
+	require.Equal(t, unix.Signal(0), sig)
+
+	sig = ParseSignal("0")
+	require.Equal(t, unix.Signal(0), sig)
+
+	sig = ParseSignal("-9")
+	require.Equal(t, unix.Signal(0), sig)
+
+	sig = ParseSignal("")
+	require.Equal(t, unix.SIGTERM, sig)
+
+	sig = ParseSignal("SIGRTMIN")
+	require.Equal(t, unix.Signal(34), sig)
+
+	sig = ParseSignal("SIGRTMIN+3")
+	require.Equal(t, unix.Signal(37), sig)
+
+	sig = ParseSignal("rtmax-2")
+	require.Equal(t, unix.Signal(62), sig)
+
+	sig = ParseSignal("SIGRTMAX")
+	require.Equal(t, unix.Signal(64), sig)
+
+	sig = ParseSignal("SIGRTMIN+31")
+	require.Equal(t, unix.Signal(0), sig)
+
+	sig = ParseSignal("SIGRTMIN-1")
+	require.Equal(t, unix.Signal(0), sig)
+
+	sig = ParseSignal("SIGRTMAX+1")
+	require.Equal(t, unix.Signal(0), sig)
+}
+
+func TestShellQuote(t *testing.T) {
+	require.Equal(t, `'/sys/fs/cgroup/a b/memory.events'`, shellQuote("/sys/fs/cgroup/a b/memory.events"))
+	require.Equal(t, `'a'\''$(b)'`, shellQuote("a'$(b)"))
+}
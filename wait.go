@@ -0,0 +1,177 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitPolling disables the event driven wait functions
+// and forces the sleep polling fallback.
+// It is used to compare the implementations in benchmarks.
+var waitPolling = false
+
+// pollFd blocks until one of the given poll events (or an error condition)
+// is signaled for fd, or the context is done.
+// The context is observed through a pipe that is polled along with fd,
+// so no busy waiting is required.
+func pollFd(ctx context.Context, fd int, events int16) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		return fmt.Errorf("failed to create cancel pipe: %w", err)
+	}
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			// #nosec
+			unix.Write(p[1], []byte{0})
+		case <-stop:
+		}
+	}()
+	// The goroutine must exit before the pipe is closed.
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	fds := []unix.PollFd{
+		{Fd: int32(fd), Events: events},
+		{Fd: int32(p[0]), Events: unix.POLLIN},
+	}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("poll failed: %w", err)
+		}
+		if fds[0].Revents != 0 {
+			return nil
+		}
+		if fds[1].Revents != 0 {
+			return ctx.Err()
+		}
+	}
+}
+
+// waitProcessExit waits until the process pid has exited.
+// The process might be a zombie if it's a child of the calling process.
+// It falls back to polling if pidfd_open is not supported.
+// If startTime is not zero, the process is identified by pid and start time.
+func waitProcessExit(ctx context.Context, pid int, startTime uint64, isRunning func() bool) error {
+	if !waitPolling {
+		fd, err := openPidfd(pid, startTime)
+		if err == unix.ESRCH || errors.Is(err, ErrStalePid) {
+			return nil
+		}
+		if err == nil {
+			defer unix.Close(fd)
+			return pollFd(ctx, fd, unix.POLLIN)
+		}
+		// ENOSYS on kernels older than 5.3
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			if !isRunning() {
+				return nil
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+	}
+}
+
+// pollCgroupEvents calls fn every time the cgroup.events file is modified
+// until fn returns true or the context is done.
+// It falls back to polling if inotify is not available.
+func pollCgroupEvents(ctx context.Context, eventsFile string, fn func(ev cgroupEvents) bool) error {
+	if !waitPolling {
+		err := watchCgroupEvents(ctx, eventsFile, fn)
+		if err != errInotify {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			ev, err := parseCgroupEvents(eventsFile)
+			if err != nil {
+				return err
+			}
+			if fn(ev) {
+				return nil
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}
+}
+
+var errInotify = fmt.Errorf("inotify is not available")
+
+// watchCgroupEvents implements pollCgroupEvents using inotify.
+// The cgroup v2 core generates a file modified event for cgroup.events,
+// whenever one of the values changes.
+// errInotify is returned if inotify can not be used.
+func watchCgroupEvents(ctx context.Context, eventsFile string, fn func(ev cgroupEvents) bool) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return errInotify
+	}
+	// Closing an inotify instance blocks for several milliseconds
+	// until the kernel has released the fsnotify group (synchronize_srcu).
+	defer func() { go unix.Close(fd) }()
+
+	// The watch must be added before the file is parsed, to not miss any event.
+	_, err = unix.InotifyAddWatch(fd, eventsFile, unix.IN_MODIFY)
+	if err == unix.ENOENT {
+		return os.ErrNotExist
+	}
+	if err != nil {
+		return errInotify
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		ev, err := parseCgroupEvents(eventsFile)
+		if err != nil {
+			return err
+		}
+		if fn(ev) {
+			return nil
+		}
+		if err := pollFd(ctx, fd, unix.POLLIN); err != nil {
+			return err
+		}
+		// Drain all queued events, the file is parsed again anyways.
+		for {
+			_, err := unix.Read(fd, buf)
+			if err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package lxcri
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// withWaitPolling runs fn with the given waitPolling value.
+func withWaitPolling(polling bool, fn func()) {
+	orig := waitPolling
+	defer func() { waitPolling = orig }()
+	waitPolling = polling
+	fn()
+}
+
+func TestWaitProcessExit(t *testing.T) {
+	for _, polling := range []bool{false, true} {
+		withWaitPolling(polling, func() {
+			cmd := exec.Command("sleep", "0.2")
+			require.NoError(t, cmd.Start())
+			pid := cmd.Process.Pid
+			startTime, err := processStartTime(pid)
+			require.NoError(t, err)
+
+			isRunning := func() bool {
+				var ws unix.WaitStatus
+				n, _ := unix.Wait4(pid, &ws, unix.WNOHANG, nil)
+				return n == 0
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+			defer cancel()
+			err = waitProcessExit(ctx, pid, startTime, isRunning)
+			require.Equal(t, context.DeadlineExceeded, err, "polling:%t", polling)
+
+			ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			err = waitProcessExit(ctx, pid, startTime, isRunning)
+			require.NoError(t, err, "polling:%t", polling)
+			isRunning()
+		})
+	}
+}
+
+func TestPollCgroupEvents(t *testing.T) {
+	for _, polling := range []bool{false, true} {
+		withWaitPolling(polling, func() {
+			eventsFile := filepath.Join(t.TempDir(), "cgroup.events")
+			require.NoError(t, os.WriteFile(eventsFile, []byte("populated 1\nfrozen 0\n"), 0644))
+
+			isFrozen := func(ev cgroupEvents) bool { return ev.frozen }
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+			defer cancel()
+			err := pollCgroupEvents(ctx, eventsFile, isFrozen)
+			require.Equal(t, context.DeadlineExceeded, err, "polling:%t", polling)
+
+			go func() {
+				time.Sleep(time.Millisecond * 10)
+				os.WriteFile(eventsFile, []byte("populated 1\nfrozen 1\n"), 0644)
+			}()
+
+			ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			err = pollCgroupEvents(ctx, eventsFile, isFrozen)
+			require.NoError(t, err, "polling:%t", polling)
+
+			err = pollCgroupEvents(ctx, filepath.Join(t.TempDir(), "cgroup.events"), isFrozen)
+			require.True(t, os.IsNotExist(err), "polling:%t", polling)
+		})
+	}
+}
+
+// BenchmarkPollCgroupEvents measures the latency from
+// a change of cgroup.events until pollCgroupEvents returns.
+// The file is modified by a separate process, like cgroup.events is modified
+// by the kernel, because a goroutine of this process can not run while the
+// only P is blocked in poll (until it's retaken by sysmon).
+func BenchmarkPollCgroupEvents(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		polling bool
+	}{{"inotify", false}, {"polling", true}} {
+		b.Run(bm.name, func(b *testing.B) {
+			withWaitPolling(bm.polling, func() {
+				eventsFile := filepath.Join(b.TempDir(), "cgroup.events")
+				ctx := context.Background()
+				for i := 0; i < b.N; i++ {
+					require.NoError(b, os.WriteFile(eventsFile, []byte("populated 1\n"), 0644))
+					cmd := exec.Command("sh", "-c", "echo 'populated 0' > "+eventsFile)
+					require.NoError(b, cmd.Start())
+					err := pollCgroupEvents(ctx, eventsFile, func(ev cgroupEvents) bool {
+						return !ev.populated
+					})
+					require.NoError(b, err)
+					require.NoError(b, cmd.Wait())
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkWaitProcessExit measures the latency from
+// the exit of a process until waitProcessExit returns.
+func BenchmarkWaitProcessExit(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		polling bool
+	}{{"pidfd", false}, {"polling", true}} {
+		b.Run(bm.name, func(b *testing.B) {
+			withWaitPolling(bm.polling, func() {
+				for i := 0; i < b.N; i++ {
+					cmd := exec.Command("sleep", "0.001")
+					require.NoError(b, cmd.Start())
+					pid := cmd.Process.Pid
+					err := waitProcessExit(context.Background(), pid, 0, func() bool {
+						return unix.Kill(pid, 0) == nil && !isZombie(pid)
+					})
+					require.NoError(b, err)
+					require.NoError(b, cmd.Wait())
+				}
+			})
+		})
+	}
+}
+
+func isZombie(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}